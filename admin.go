@@ -0,0 +1,163 @@
+package uwebsocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Maximum size of a message pushed through the AdminHandler
+const adminMaxMessageSize = 1 << 20
+
+// Returns a handler with JSON endpoints for operating the hub, mount it with http.StripPrefix.
+// Every request has to pass authorize, without it all requests are forbidden.
+// Filters are passed as filter expressions (see ParseFilter) in the query parameter "filter".
+//   - GET /stats: Stats of the hub
+//   - GET /clients?filter=&offset=&limit=: matching clients ({"clients": [...], "total": n})
+//   - GET /clients/count?filter=: number of matching clients
+//   - GET /clients/{clientGUID}: a client with its ClientStats
+//   - DELETE /clients/{clientGUID}: disconnect a client
+//   - POST /send?filter=: send the request body to the matching clients
+//   - POST /kick?filter=: disconnect the matching clients (the filter is required)
+func (h *webSocketHub) AdminHandler(authorize func(r *http.Request) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authorize == nil || !authorize(r) {
+			writeAdminError(w, http.StatusForbidden, errors.New("forbidden"))
+			return
+		}
+
+		path := "/" + strings.Trim(r.URL.Path, "/")
+		switch {
+		case path == "/stats" && r.Method == http.MethodGet:
+			writeAdminJSON(w, h.Stats())
+		case path == "/clients" && r.Method == http.MethodGet:
+			h.adminListClients(w, r)
+		case path == "/clients/count" && r.Method == http.MethodGet:
+			filter, ok := adminFilter(w, r, false)
+			if ok {
+				writeAdminJSON(w, map[string]int{"count": h.CountClientsWithFilter(filter)})
+			}
+		case strings.HasPrefix(path, "/clients/") && r.Method == http.MethodGet:
+			h.adminGetClient(w, strings.TrimPrefix(path, "/clients/"))
+		case strings.HasPrefix(path, "/clients/") && r.Method == http.MethodDelete:
+			clientGUID := strings.TrimPrefix(path, "/clients/")
+			if h.kickClients(r, func(guid string, attrs *ClientAttributes) bool { return guid == clientGUID }) == 0 {
+				writeAdminError(w, http.StatusNotFound, ErrClientNotFound)
+				return
+			}
+			writeAdminJSON(w, map[string]int{"kicked": 1})
+		case path == "/send" && r.Method == http.MethodPost:
+			h.adminSend(w, r)
+		case path == "/kick" && r.Method == http.MethodPost:
+			filter, ok := adminFilter(w, r, true)
+			if ok {
+				writeAdminJSON(w, map[string]int{"kicked": h.kickClients(r, filter)})
+			}
+		default:
+			writeAdminError(w, http.StatusNotFound, fmt.Errorf("unknown endpoint %s %s", r.Method, path))
+		}
+	})
+}
+
+func (h *webSocketHub) adminListClients(w http.ResponseWriter, r *http.Request) {
+	filter, ok := adminFilter(w, r, false)
+	if !ok {
+		return
+	}
+	page := Pagination{}
+	for param, target := range map[string]*int{"offset": &page.Offset, "limit": &page.Limit} {
+		if value := r.URL.Query().Get(param); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				writeAdminError(w, http.StatusBadRequest, fmt.Errorf("invalid %s %q", param, value))
+				return
+			}
+			*target = parsed
+		}
+	}
+
+	clients, total := h.ListClients(filter, page)
+	writeAdminJSON(w, map[string]interface{}{"clients": clients, "total": total})
+}
+
+func (h *webSocketHub) adminGetClient(w http.ResponseWriter, clientGUID string) {
+	clients, _ := h.ListClients(func(guid string, attrs *ClientAttributes) bool { return guid == clientGUID }, Pagination{})
+	stats, err := h.ClientStats(clientGUID)
+	if len(clients) == 0 || err != nil {
+		writeAdminError(w, http.StatusNotFound, ErrClientNotFound)
+		return
+	}
+	writeAdminJSON(w, map[string]interface{}{"client": clients[0], "stats": stats})
+}
+
+func (h *webSocketHub) adminSend(w http.ResponseWriter, r *http.Request) {
+	filter, ok := adminFilter(w, r, false)
+	if !ok {
+		return
+	}
+	message, err := io.ReadAll(http.MaxBytesReader(w, r.Body, adminMaxMessageSize))
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("could not read message (%s)", err))
+		return
+	}
+
+	matched := h.CountClientsWithFilter(filter)
+	h.logEvent(LogEventAdmin, "uwebsocket: admin sent message",
+		slog.String("filter", r.URL.Query().Get("filter")),
+		slog.Int("matched", matched),
+		slog.String("remoteAddr", r.RemoteAddr),
+	)
+	if err := h.SendCtx(r.Context(), WithMessage(message), WithFilterFn(filter)); err != nil {
+		writeAdminError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	writeAdminJSON(w, map[string]int{"matched": matched})
+}
+
+// disconnects all matching clients with CloseKicked, returns how many were disconnected
+func (h *webSocketHub) kickClients(r *http.Request, filterFunc func(clientGUID string, attrs *ClientAttributes) bool) int {
+	h.clientLock.Lock()
+	kicked := []WebSocketClient{}
+	for _, client := range h.clients {
+		if filterFunc(client.ClientGUID(), client.Attributes()) && h.closeClient(client, CloseKicked, "kicked", DisconnectKicked) {
+			kicked = append(kicked, client)
+		}
+	}
+	h.clientLock.Unlock()
+
+	for _, client := range kicked {
+		h.logClientEvent(client, LogEventAdmin, "uwebsocket: admin kicked client", slog.String("adminRemoteAddr", r.RemoteAddr))
+	}
+	return len(kicked)
+}
+
+// parses the filter expression of the request, writes an error if it is invalid (or missing, if required)
+func adminFilter(w http.ResponseWriter, r *http.Request, required bool) (func(clientGUID string, attrs *ClientAttributes) bool, bool) {
+	expression := r.URL.Query().Get("filter")
+	if required && strings.TrimSpace(expression) == "" {
+		writeAdminError(w, http.StatusBadRequest, errors.New("filter is required"))
+		return nil, false
+	}
+	filter, err := ParseFilter(expression)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+	return filter, true
+}
+
+func writeAdminJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeAdminError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
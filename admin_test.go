@@ -0,0 +1,85 @@
+package uwebsocket
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminHandler(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	h, c1, c2 := createTestSetup(t, ctx)
+	admin := h.AdminHandler(func(r *http.Request) bool { return r.Header.Get("Authorization") == "secret" })
+
+	request := func(method string, target string, body string) (int, map[string]interface{}) {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Authorization", "secret")
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, r)
+		response := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+
+	// unauthorized
+	w := httptest.NewRecorder()
+	admin.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	code, response := request(http.MethodGet, "/stats", "")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, float64(2), response["Clients"])
+
+	code, response = request(http.MethodGet, "/clients/count?filter="+testClientFlag, "")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, float64(1), response["count"])
+
+	code, response = request(http.MethodGet, "/clients?limit=1", "")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, float64(2), response["total"])
+	clients := response["clients"].([]interface{})
+	require.Len(t, clients, 1)
+	client := clients[0].(map[string]interface{})
+	require.Equal(t, testClientGUID1, client["ClientGUID"])
+	require.Equal(t, testClient1Value, client["Attributes"].(map[string]interface{})[testClientKey])
+
+	code, response = request(http.MethodGet, "/clients/"+testClientGUID2, "")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, testClientGUID2, response["stats"].(map[string]interface{})["ClientGUID"])
+
+	code, _ = request(http.MethodGet, "/clients/unknown", "")
+	require.Equal(t, http.StatusNotFound, code)
+	code, _ = request(http.MethodGet, "/clients?filter==a", "")
+	require.Equal(t, http.StatusBadRequest, code)
+
+	// send to a filter
+	code, response = request(http.MethodPost, "/send?filter="+testClientKey+"="+testClient2Value, string(message1))
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, float64(1), response["matched"])
+	received, err := c2.readOne()
+	require.NoError(t, err)
+	require.Equal(t, message1, received)
+	_, err = c1.readOne()
+	require.Error(t, err)
+
+	// kick clients
+	code, _ = request(http.MethodPost, "/kick", "")
+	require.Equal(t, http.StatusBadRequest, code)
+	code, response = request(http.MethodPost, "/kick?filter="+testClientFlag, "")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, float64(1), response["kicked"])
+	require.True(t, c1.calledCancel.Load())
+
+	code, response = request(http.MethodDelete, "/clients/"+testClientGUID2, "")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, float64(1), response["kicked"])
+	require.True(t, c2.calledCancel.Load())
+	require.Equal(t, 0, h.CountClientsWithFilter(func(clientGUID string, attrs *ClientAttributes) bool { return true }))
+}
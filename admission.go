@@ -0,0 +1,187 @@
+package uwebsocket
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Limits for accepting connections, zero values are unlimited
+type AdmissionLimits struct {
+	MaxConnections      int
+	MaxConnectionsPerIP int
+
+	// per value of a string attribute, e.g. {"tenant": 100}, clients without the attribute are not limited
+	MaxConnectionsPerAttribute map[string]int
+
+	// new connections per second and IP, allowing bursts of up to ConnectionBurst
+	ConnectionRate  float64
+	ConnectionBurst int
+
+	// IP of the request, defaults to the host of RemoteAddr (set this when running behind a proxy)
+	ClientIP func(r *http.Request) string
+}
+
+// Why a connection was not admitted
+type AdmissionRejection string
+
+const (
+	RejectMaxConnections             AdmissionRejection = "maxConnections"
+	RejectMaxConnectionsPerIP        AdmissionRejection = "maxConnectionsPerIP"
+	RejectMaxConnectionsPerAttribute AdmissionRejection = "maxConnectionsPerAttribute"
+	RejectConnectionRate             AdmissionRejection = "connectionRate"
+)
+
+// the server is full (503), everything else is caused by the client (429)
+func (r AdmissionRejection) status() int {
+	if r == RejectMaxConnections {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusTooManyRequests
+}
+
+// how often idle rate-limiting buckets are forgotten
+const admissionSweepInterval = time.Minute
+
+// counts the connections admitted with one set of limits
+type admissionController struct {
+	limits AdmissionLimits
+
+	lock         sync.Mutex
+	total        int
+	perIP        map[string]int
+	perAttribute map[[2]string]int
+	rates        map[string]*tokenBucket
+	lastSweep    time.Time
+}
+
+func newAdmissionController(limits AdmissionLimits) *admissionController {
+	return &admissionController{
+		limits:       limits,
+		perIP:        map[string]int{},
+		perAttribute: map[[2]string]int{},
+		rates:        map[string]*tokenBucket{},
+		lastSweep:    time.Now(),
+	}
+}
+
+func (a *admissionController) clientIP(r *http.Request) string {
+	if a.limits.ClientIP != nil {
+		return a.limits.ClientIP(r)
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// reserves a connection, release has to be called once the connection is closed
+func (a *admissionController) admit(r *http.Request, attrs *ClientAttributes) (release func(), rejection AdmissionRejection, ok bool) {
+	if a == nil {
+		return func() {}, "", true
+	}
+	ip := a.clientIP(r)
+	attributes := [][2]string{}
+	for key, limit := range a.limits.MaxConnectionsPerAttribute {
+		if limit <= 0 {
+			continue
+		}
+		if value, err := attrs.GetString(key); err == nil {
+			attributes = append(attributes, [2]string{key, value})
+		}
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.limits.MaxConnections > 0 && a.total >= a.limits.MaxConnections {
+		return nil, RejectMaxConnections, false
+	}
+	if a.limits.MaxConnectionsPerIP > 0 && a.perIP[ip] >= a.limits.MaxConnectionsPerIP {
+		return nil, RejectMaxConnectionsPerIP, false
+	}
+	for _, attribute := range attributes {
+		if a.perAttribute[attribute] >= a.limits.MaxConnectionsPerAttribute[attribute[0]] {
+			return nil, RejectMaxConnectionsPerAttribute, false
+		}
+	}
+	if a.limits.ConnectionRate > 0 && !a.takeRate(ip) {
+		return nil, RejectConnectionRate, false
+	}
+
+	a.total++
+	a.perIP[ip]++
+	for _, attribute := range attributes {
+		a.perAttribute[attribute]++
+	}
+
+	once := sync.Once{}
+	return func() {
+		once.Do(func() {
+			a.lock.Lock()
+			defer a.lock.Unlock()
+			a.total--
+			decrement(a.perIP, ip)
+			for _, attribute := range attributes {
+				decrement(a.perAttribute, attribute)
+			}
+		})
+	}, "", true
+}
+
+// must be called with the lock held
+func (a *admissionController) takeRate(ip string) bool {
+	now := time.Now()
+	if now.Sub(a.lastSweep) > admissionSweepInterval {
+		for key, bucket := range a.rates {
+			if bucket.full(now) {
+				delete(a.rates, key)
+			}
+		}
+		a.lastSweep = now
+	}
+
+	bucket, ok := a.rates[ip]
+	if !ok {
+		bucket = newTokenBucket(a.limits.ConnectionRate, a.limits.ConnectionBurst, now)
+		a.rates[ip] = bucket
+	}
+	return bucket.take(now, 1)
+}
+
+func decrement[K comparable](counts map[K]int, key K) {
+	if counts[key] <= 1 {
+		delete(counts, key)
+		return
+	}
+	counts[key]--
+}
+
+// reserves a connection with the limits of the hub and the handler
+func (h *webSocketHub) admit(handler Handler, r *http.Request, attrs *ClientAttributes) (release func(), rejection AdmissionRejection, ok bool) {
+	releaseHub, rejection, ok := h.opts.admission.admit(r, attrs)
+	if ok {
+		var releaseHandler func()
+		releaseHandler, rejection, ok = handler.wsOpts.admission.admit(r, attrs)
+		if ok {
+			return func() {
+				releaseHandler()
+				releaseHub()
+			}, "", true
+		}
+		releaseHub()
+	}
+
+	h.logEvent(LogEventAdmissionRejected, "uwebsocket: rejected connection",
+		slog.String("reason", string(rejection)),
+		slog.String("remoteAddr", r.RemoteAddr),
+		slog.String("pattern", handler.wsOpts.pattern),
+	)
+	h.metrics.rejected(handler.wsOpts.pattern, rejection)
+	if h.opts.onAdmissionRejected != nil {
+		(*h.opts.onAdmissionRejected)(h, rejection, r)
+	}
+	return nil, rejection, false
+}
@@ -0,0 +1,107 @@
+package uwebsocket
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdmission(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	registry := prometheus.NewRegistry()
+	rejections := atomic.Int64{}
+	h := NewHub(websocket.TextMessage, ctx,
+		WithMetrics(registry),
+		WithHubAdmissionLimits(AdmissionLimits{MaxConnections: 3}),
+		WithOnAdmissionRejected(func(hub WebSocketHub, rejection AdmissionRejection, r *http.Request) {
+			rejections.Add(1)
+		}),
+	)
+	go h.Run()
+
+	mux := http.NewServeMux()
+	mux.Handle("/ip", h.HTTPHandler(NewHandler(WithPattern("/ip"), WithAdmissionLimits(AdmissionLimits{MaxConnectionsPerIP: 1}))))
+	mux.Handle("/tenant", h.HTTPHandler(NewHandler(
+		WithPattern("/tenant"),
+		WithAdmissionLimits(AdmissionLimits{MaxConnectionsPerAttribute: map[string]int{"tenant": 1}}),
+		WithClientAttributes(func(hub WebSocketHub, r *http.Request) (*ClientAttributes, error) {
+			return NewClientAttributes().SetString("tenant", r.URL.Query().Get("tenant")), nil
+		}),
+	)))
+	mux.Handle("/rate", h.HTTPHandler(NewHandler(WithPattern("/rate"), WithAdmissionLimits(AdmissionLimits{ConnectionRate: 0.001, ConnectionBurst: 1}))))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	dial := func(path string, expectedStatus int) *websocket.Conn {
+		conn, response, err := websocket.DefaultDialer.Dial(url+path, nil)
+		if expectedStatus == http.StatusSwitchingProtocols {
+			require.NoError(t, err, path)
+			return conn
+		}
+		require.Error(t, err, path)
+		require.Equal(t, expectedStatus, response.StatusCode, path)
+		return nil
+	}
+
+	// per IP
+	ip := dial("/ip", http.StatusSwitchingProtocols)
+	dial("/ip", http.StatusTooManyRequests)
+
+	// per attribute value
+	tenant := dial("/tenant?tenant=a", http.StatusSwitchingProtocols)
+	dial("/tenant?tenant=a", http.StatusTooManyRequests)
+
+	// rate per IP
+	rate := dial("/rate", http.StatusSwitchingProtocols)
+	defer rate.Close()
+
+	// total of the hub
+	dial("/tenant?tenant=b", http.StatusServiceUnavailable)
+	dial("/rate", http.StatusServiceUnavailable)
+
+	require.Equal(t, int64(4), rejections.Load())
+	require.Equal(t, float64(2), gatheredValue(t, registry, "uwebsocket_admission_rejections_total", map[string]string{"reason": string(RejectMaxConnections)}))
+	require.Equal(t, float64(1), gatheredValue(t, registry, "uwebsocket_admission_rejections_total", map[string]string{"pattern": "/ip"}))
+
+	// closed connections free their slots, the rate limit remains
+	ip.Close()
+	tenant.Close()
+	require.Eventually(t, func() bool {
+		conn, _, err := websocket.DefaultDialer.Dial(url+"/ip", nil)
+		if err == nil {
+			defer conn.Close()
+		}
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	dial("/rate", http.StatusTooManyRequests)
+}
+
+func TestAdmissionZeroLimitsAreUnlimited(t *testing.T) {
+	a := newAdmissionController(AdmissionLimits{MaxConnectionsPerAttribute: map[string]int{"tenant": 0, "region": 1}})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	tenant := NewClientAttributes().SetString("tenant", "a")
+	for i := 0; i < 3; i++ {
+		_, rejection, ok := a.admit(r, tenant)
+		require.True(t, ok, rejection)
+	}
+
+	// the other limits still apply
+	region := NewClientAttributes().SetString("tenant", "a").SetString("region", "eu")
+	_, _, ok := a.admit(r, region)
+	require.True(t, ok)
+	_, rejection, ok := a.admit(r, region)
+	require.False(t, ok)
+	require.Equal(t, RejectMaxConnectionsPerAttribute, rejection)
+}
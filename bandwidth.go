@@ -0,0 +1,150 @@
+package uwebsocket
+
+import (
+	"sync"
+	"time"
+)
+
+// Outbound budgets of a handler's clients, zero rates are unlimited.
+// While a client waits for budget, further messages stay in its send-buffer, so the
+// overflow-policy, priorities and conflation decide what is sent next. Messages which expire while waiting are dropped.
+// Pings are not delayed. Once the client is removed from the hub (e.g. by Shutdown) it no longer waits,
+// unless its remaining messages are discarded (e.g. when it is kicked).
+type BandwidthLimit struct {
+	// budget of every single client
+	BytesPerSecond float64
+	Burst          int
+
+	// budget shared by all clients with the same value of this string attribute (e.g. "tenant"),
+	// clients without the attribute only have their own budget
+	GroupAttribute      string
+	GroupBytesPerSecond float64
+	GroupBurst          int
+}
+
+// shapes the outbound traffic of the clients of a handler
+type bandwidthShaper struct {
+	limit BandwidthLimit
+
+	lock   sync.Mutex
+	groups map[string]*bandwidthGroup
+}
+
+type bandwidthGroup struct {
+	bucket  *tokenBucket
+	clients int
+}
+
+func newBandwidthShaper(limit BandwidthLimit) *bandwidthShaper {
+	return &bandwidthShaper{
+		limit:  limit,
+		groups: map[string]*bandwidthGroup{},
+	}
+}
+
+// budgets of a single client, only used by its writePump
+type clientShaper struct {
+	shaper *bandwidthShaper
+	bucket *tokenBucket
+	group  *bandwidthGroup
+	name   string
+}
+
+func (s *bandwidthShaper) join(attrs *ClientAttributes) *clientShaper {
+	now := time.Now()
+	c := &clientShaper{shaper: s}
+	if s.limit.BytesPerSecond > 0 {
+		c.bucket = newTokenBucket(s.limit.BytesPerSecond, s.limit.Burst, now)
+	}
+	if s.limit.GroupBytesPerSecond <= 0 || s.limit.GroupAttribute == "" {
+		return c
+	}
+	name, err := attrs.GetString(s.limit.GroupAttribute)
+	if err != nil {
+		return c
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	group, ok := s.groups[name]
+	if !ok {
+		group = &bandwidthGroup{bucket: newTokenBucket(s.limit.GroupBytesPerSecond, s.limit.GroupBurst, now)}
+		s.groups[name] = group
+	}
+	group.clients++
+	c.group = group
+	c.name = name
+	return c
+}
+
+// forgets the group once its last client left
+func (c *clientShaper) leave() {
+	if c.group == nil {
+		return
+	}
+	c.shaper.lock.Lock()
+	defer c.shaper.lock.Unlock()
+	c.group.clients--
+	if c.group.clients == 0 {
+		delete(c.shaper.groups, c.name)
+	}
+}
+
+// takes the bytes of a write from the budgets, returns how long to wait before writing.
+// Reservations are served in order, so clients of a group take turns.
+func (c *clientShaper) reserve(now time.Time, bytes int) time.Duration {
+	wait := time.Duration(0)
+	if c.bucket != nil {
+		wait = c.bucket.reserve(now, float64(bytes))
+	}
+	if c.group != nil {
+		c.shaper.lock.Lock()
+		wait = max(wait, c.group.bucket.reserve(now, float64(bytes)))
+		c.shaper.lock.Unlock()
+	}
+	return wait
+}
+
+// a batch waiting for bandwidth budget, only used by the writePump
+type throttledBatch struct {
+	batch []*queuedMessage
+	since time.Time
+	timer *time.Timer
+}
+
+// reserves budget for the batch, returns nil if it can be written right away
+func (c *webSocketClient) throttle(batch []*queuedMessage) *throttledBatch {
+	size := 0
+	for _, message := range batch {
+		size += len(message.payload)
+	}
+	wait := c.shaper.reserve(time.Now(), size)
+	if wait <= 0 {
+		return nil
+	}
+	return &throttledBatch{batch: batch, since: time.Now(), timer: time.NewTimer(wait)}
+}
+
+// ends the wait, returns the messages which have not expired meanwhile
+func (t *throttledBatch) release(c *webSocketClient) []*queuedMessage {
+	t.timer.Stop()
+	now := time.Now()
+	c.hub.metrics.throttled(c.handler.wsOpts.pattern, now.Sub(t.since))
+
+	valid := t.batch[:0]
+	for _, message := range t.batch {
+		if message.expired(now) {
+			c.hub.recordDrop(c, DropExpired)
+			continue
+		}
+		valid = append(valid, message)
+	}
+	return valid
+}
+
+// ends the wait without writing the batch
+func (t *throttledBatch) drop(c *webSocketClient) {
+	for range t.release(c) {
+		c.hub.recordDrop(c, DropClosed)
+	}
+}
@@ -0,0 +1,153 @@
+package uwebsocket
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBandwidthLimit(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	h := NewHub(websocket.TextMessage, ctx)
+	go h.Run()
+	tenantAttributes := WithClientAttributes(func(hub WebSocketHub, r *http.Request) (*ClientAttributes, error) {
+		return NewClientAttributes().SetString("tenant", r.URL.Query().Get("tenant")).SetString("path", r.URL.Path), nil
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/client", h.HTTPHandler(NewHandler(tenantAttributes, WithBandwidthLimit(BandwidthLimit{BytesPerSecond: 2000, Burst: 100}))))
+	mux.Handle("/group", h.HTTPHandler(NewHandler(tenantAttributes, WithBandwidthLimit(BandwidthLimit{GroupAttribute: "tenant", GroupBytesPerSecond: 2000, GroupBurst: 100}))))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	dial := func(path string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+path, nil)
+		require.NoError(t, err)
+		return conn
+	}
+	single := dial("/client?tenant=x")
+	defer single.Close()
+	a1 := dial("/group?tenant=a")
+	defer a1.Close()
+	a2 := dial("/group?tenant=a")
+	defer a2.Close()
+	b := dial("/group?tenant=b")
+	defer b.Close()
+	require.Eventually(t, func() bool {
+		return h.CountClientsWithFilter(func(clientGUID string, attrs *ClientAttributes) bool { return true }) == 4
+	}, time.Second, 10*time.Millisecond)
+
+	message := bytes.Repeat([]byte("x"), 100)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		h.Send(WithMessage(message), WithMatchFilter("path", "/client"))
+	}
+	for i := 0; i < 3; i++ {
+		h.Send(WithMessage(message), WithMatchFilter("path", "/group"))
+	}
+
+	received := sync.Map{}
+	wg := sync.WaitGroup{}
+	for name, c := range map[string]struct {
+		conn     *websocket.Conn
+		messages int
+	}{"single": {single, 5}, "a1": {a1, 3}, "a2": {a2, 3}, "b": {b, 3}} {
+		wg.Add(1)
+		go func(name string, conn *websocket.Conn, messages int) {
+			defer wg.Done()
+			for i := 0; i < messages; i++ {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+			received.Store(name, time.Since(start))
+		}(name, c.conn, c.messages)
+	}
+	wg.Wait()
+	elapsed := func(name string) time.Duration {
+		value, _ := received.Load(name)
+		return value.(time.Duration)
+	}
+
+	// 500 bytes at 2000 bytes/s, of which 100 bytes burst are sent immediately
+	require.GreaterOrEqual(t, elapsed("single"), 190*time.Millisecond)
+
+	// tenant a shares its budget (600 bytes), both clients take turns once the burst is used up
+	// (one client finishing all its messages first would be 150ms ahead)
+	require.GreaterOrEqual(t, max(elapsed("a1"), elapsed("a2")), 240*time.Millisecond)
+	require.Less(t, (elapsed("a1") - elapsed("a2")).Abs(), 120*time.Millisecond)
+
+	// tenant b has its own budget (300 bytes)
+	require.Less(t, elapsed("b"), max(elapsed("a1"), elapsed("a2")))
+	require.GreaterOrEqual(t, elapsed("b"), 90*time.Millisecond)
+}
+
+func TestBandwidthLimitDoesNotDelayClosing(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	h := NewHub(websocket.TextMessage, ctx).(*webSocketHub)
+	go h.Run()
+	server := httptest.NewServer(h.HTTPHandler(NewHandler(WithBandwidthLimit(BandwidthLimit{BytesPerSecond: 100, Burst: 500}))))
+	defer server.Close()
+
+	dial := func() *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			return h.CountClientsWithFilter(func(clientGUID string, attrs *ClientAttributes) bool { return true }) == 1
+		}, time.Second, 10*time.Millisecond)
+		return conn
+	}
+	// the first message uses up the burst, the second one would wait 5 seconds for budget
+	message := bytes.Repeat([]byte("x"), 500)
+	send := func() {
+		h.Send(WithMessage(message))
+		h.Send(WithMessage(message))
+	}
+
+	// kicking discards the throttled message right away
+	conn := dial()
+	defer conn.Close()
+	send()
+	_, received, err := conn.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, message, received)
+	start := time.Now()
+	h.clientLock.Lock()
+	for _, client := range h.clients {
+		h.closeClient(client, CloseKicked, "kicked", DisconnectKicked)
+	}
+	h.clientLock.Unlock()
+	_, _, err = conn.ReadMessage()
+	require.True(t, websocket.IsCloseError(err, CloseKicked), err)
+	require.Less(t, time.Since(start), time.Second)
+	require.Equal(t, int64(1), h.Stats().Drops[DropClosed])
+
+	// shutting down writes what is left without waiting for budget
+	conn = dial()
+	defer conn.Close()
+	send()
+	shutdownCtx, shutdownCancel := context.WithTimeout(ctx, 2*time.Second)
+	defer shutdownCancel()
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- h.Shutdown(shutdownCtx) }()
+	for i := 0; i < 2; i++ {
+		_, received, err := conn.ReadMessage()
+		require.NoError(t, err)
+		require.Equal(t, message, received)
+	}
+	_, _, err = conn.ReadMessage()
+	require.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), err)
+	require.NoError(t, <-shutdown)
+}
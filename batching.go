@@ -0,0 +1,95 @@
+package uwebsocket
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// How multiple messages are combined into a single websocket frame
+type Framing int
+
+const (
+	// Messages separated by a newline
+	FramingNewline Framing = iota
+	// Messages as elements of a JSON array (every message must be valid JSON)
+	FramingJSONArray
+	// Every message prefixed with its length as big-endian uint32, always sent as binary frame (also by text hubs)
+	FramingLengthPrefixed
+)
+
+func (f Framing) String() string {
+	switch f {
+	case FramingNewline:
+		return "newline"
+	case FramingJSONArray:
+		return "jsonArray"
+	case FramingLengthPrefixed:
+		return "lengthPrefixed"
+	default:
+		return fmt.Sprintf("Framing(%d)", int(f))
+	}
+}
+
+// Configuration for writing queued messages as one frame
+type BatchOptions struct {
+	// How messages are combined
+	Framing Framing
+	// Stop collecting once this many messages are in the batch (0: no limit)
+	MaxMessages int
+	// Stop collecting once the batch has at least this many bytes (0: no limit)
+	MaxBytes int
+	// How long to wait for more messages after the first one, before writing
+	// a batch that has not reached one of the limits (0: only take what is already queued)
+	MaxDelay time.Duration
+}
+
+func (o *BatchOptions) full(messages int, bytes int) bool {
+	return (o.MaxMessages > 0 && messages >= o.MaxMessages) || (o.MaxBytes > 0 && bytes >= o.MaxBytes)
+}
+
+func (f Framing) write(w io.Writer, batch [][]byte) error {
+	switch f {
+	case FramingJSONArray:
+		if _, err := w.Write([]byte{'['}); err != nil {
+			return err
+		}
+		for i, message := range batch {
+			if i > 0 {
+				if _, err := w.Write([]byte{','}); err != nil {
+					return err
+				}
+			}
+			if _, err := w.Write(message); err != nil {
+				return err
+			}
+		}
+		_, err := w.Write([]byte{']'})
+		return err
+	case FramingLengthPrefixed:
+		prefix := make([]byte, 4)
+		for _, message := range batch {
+			binary.BigEndian.PutUint32(prefix, uint32(len(message)))
+			if _, err := w.Write(prefix); err != nil {
+				return err
+			}
+			if _, err := w.Write(message); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		for i, message := range batch {
+			if i > 0 {
+				if _, err := w.Write(newline); err != nil {
+					return err
+				}
+			}
+			if _, err := w.Write(message); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,124 @@
+package uwebsocket
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFraming(t *testing.T) {
+	batch := [][]byte{[]byte(`{"a":1}`), []byte(`{"b":2}`)}
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, FramingNewline.write(buf, batch))
+	require.Equal(t, "{\"a\":1}\n{\"b\":2}", buf.String())
+
+	buf.Reset()
+	require.NoError(t, FramingJSONArray.write(buf, batch))
+	require.Equal(t, `[{"a":1},{"b":2}]`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, FramingLengthPrefixed.write(buf, batch))
+	require.Equal(t, append(append([]byte{0, 0, 0, 7}, batch[0]...), append([]byte{0, 0, 0, 7}, batch[1]...)...), buf.Bytes())
+}
+
+func TestBatchLimits(t *testing.T) {
+	require.False(t, (&BatchOptions{}).full(100, 1<<20))
+	require.True(t, (&BatchOptions{MaxMessages: 2}).full(2, 0))
+	require.False(t, (&BatchOptions{MaxMessages: 2}).full(1, 100))
+	require.True(t, (&BatchOptions{MaxBytes: 100}).full(1, 100))
+}
+
+func TestWriteBatches(t *testing.T) {
+	hub := &webSocketHub{messageType: websocket.TextMessage, stats: newHubStats()}
+	conns := make(chan *websocket.Conn)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conns <- conn
+	}))
+	defer server.Close()
+
+	connect := func(opts BatchOptions) (*webSocketClient, *websocket.Conn) {
+		peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+		require.NoError(t, err)
+		conn := <-conns
+		t.Cleanup(func() {
+			peer.Close()
+			conn.Close()
+		})
+		return &webSocketClient{hub: hub, conn: conn, send: newSendQueue(10), handler: NewHandler(WithBatching(opts)), activityStats: newClientActivity()}, peer
+	}
+	push := func(client *webSocketClient, message string, batchable bool) {
+		if _, err := client.send.push(context.Background(), &queuedMessage{payload: []byte(message), batchable: batchable}, OverflowDrop); err != nil {
+			t.Error(err)
+		}
+	}
+	writeQueued := func(client *webSocketClient) {
+		throttled, closed, err := client.writeQueued(context.Background())
+		require.NoError(t, err)
+		require.Nil(t, throttled)
+		require.False(t, closed)
+	}
+	requireFrames := func(peer *websocket.Conn, frames ...string) {
+		for _, frame := range frames {
+			_, received, err := peer.ReadMessage()
+			require.NoError(t, err)
+			require.Equal(t, frame, string(received))
+		}
+	}
+
+	// at most MaxMessages per frame, messages of the hub itself are written on their own
+	client, peer := connect(BatchOptions{Framing: FramingJSONArray, MaxMessages: 2})
+	push(client, `{"a":1}`, true)
+	push(client, `{"b":2}`, true)
+	push(client, `{"c":3}`, true)
+	push(client, "PONG", false)
+	push(client, `{"d":4}`, true)
+	writeQueued(client)
+	requireFrames(peer, `[{"a":1},{"b":2}]`, `[{"c":3}]`, "PONG", `[{"d":4}]`)
+
+	// a frame is complete once it has at least MaxBytes
+	client, peer = connect(BatchOptions{Framing: FramingNewline, MaxBytes: 8})
+	push(client, "12345", true)
+	push(client, "678", true)
+	push(client, "9", true)
+	writeQueued(client)
+	requireFrames(peer, "12345\n678", "9")
+
+	// length prefixes are binary, even if the hub sends text
+	client, peer = connect(BatchOptions{Framing: FramingLengthPrefixed})
+	push(client, "1", true)
+	push(client, "PONG", false)
+	writeQueued(client)
+	messageType, received, err := peer.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, websocket.BinaryMessage, messageType)
+	require.Equal(t, []byte{0, 0, 0, 1, '1'}, received)
+	messageType, received, err = peer.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, websocket.TextMessage, messageType)
+	require.Equal(t, "PONG", string(received))
+
+	// messages arriving within MaxDelay are combined
+	client, peer = connect(BatchOptions{Framing: FramingNewline, MaxDelay: 200 * time.Millisecond})
+	push(client, "1", true)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		push(client, "2", true)
+	}()
+	start := time.Now()
+	writeQueued(client)
+	require.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+	requireFrames(peer, "1\n2")
+}
@@ -1,9 +1,11 @@
 package uwebsocket
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"sort"
 	"strings"
 
 	"github.com/dunv/uhelpers"
@@ -70,8 +72,62 @@ func (c *ClientAttributes) String() string {
 		case *bool:
 			out = append(out, fmt.Sprintf("%s: %t", k, *typed))
 		default:
-			log.Printf("uwebsocket.ClientAttributes: unknown type %T\n", typed)
+			out = append(out, fmt.Sprintf("%s: %v", k, typed))
 		}
 	}
 	return strings.Join(out, ", ")
 }
+
+// Attributes as a group for structured logging
+func (c *ClientAttributes) LogValue() slog.Value {
+	keys := make([]string, 0, len(c.attrs))
+	for k := range c.attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]slog.Attr, 0, len(keys))
+	for _, k := range keys {
+		switch typed := c.attrs[k].(type) {
+		case *string:
+			attrs = append(attrs, slog.String(k, *typed))
+		case *bool:
+			attrs = append(attrs, slog.Bool(k, *typed))
+		default:
+			attrs = append(attrs, slog.Any(k, typed))
+		}
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// copy containing only the given keys
+func (c *ClientAttributes) subset(keys ...string) *ClientAttributes {
+	subset := NewClientAttributes()
+	for _, k := range keys {
+		if v, ok := c.attrs[k]; ok {
+			subset.attrs[k] = v
+		}
+	}
+	return subset
+}
+
+// Copy which is not affected by later changes to the attributes
+func (c *ClientAttributes) Copy() *ClientAttributes {
+	copied := NewClientAttributes()
+	for k, v := range c.attrs {
+		switch typed := v.(type) {
+		case *string:
+			copied.attrs[k] = uhelpers.Ptr(*typed)
+		case *bool:
+			copied.attrs[k] = uhelpers.Ptr(*typed)
+		default:
+			copied.attrs[k] = typed
+		}
+	}
+	return copied
+}
+
+// Attributes as a JSON object
+func (c *ClientAttributes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.attrs)
+}
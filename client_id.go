@@ -0,0 +1,33 @@
+package uwebsocket
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// What happens if a client connects with a GUID which is already in use
+type ClientIDCollisionPolicy int
+
+const (
+	// Reject the new connection (default)
+	CollisionRejectNew ClientIDCollisionPolicy = iota
+	// Disconnect the existing client and accept the new one
+	CollisionKickOld
+)
+
+func (p ClientIDCollisionPolicy) String() string {
+	switch p {
+	case CollisionRejectNew:
+		return "rejectNew"
+	case CollisionKickOld:
+		return "kickOld"
+	default:
+		return fmt.Sprintf("ClientIDCollisionPolicy(%d)", int(p))
+	}
+}
+
+func defaultClientIDGenerator(r *http.Request, attrs *ClientAttributes) (string, error) {
+	return uuid.New().String(), nil
+}
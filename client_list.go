@@ -0,0 +1,70 @@
+package uwebsocket
+
+import (
+	"sort"
+	"time"
+)
+
+// Read-only snapshot of a connected client, see WebSocketHub.ListClients
+type ClientInfo struct {
+	ClientGUID  string
+	Attributes  *ClientAttributes
+	RemoteAddr  string
+	UserAgent   string
+	ConnectedAt time.Time
+	Pattern     string
+	Subprotocol string
+}
+
+// Selects a page of a listing, a Limit of 0 returns everything after Offset
+type Pagination struct {
+	Offset int
+	Limit  int
+}
+
+// Lists the clients matching the filter (all if nil), ordered by their GUID.
+// total is the number of matching clients, regardless of pagination.
+// The attributes are copied, changing them does not affect the client.
+func (h *webSocketHub) ListClients(filterFunc func(clientGUID string, attrs *ClientAttributes) bool, page Pagination) (clients []ClientInfo, total int) {
+	// only evaluate the filter while holding the lock, snapshots are taken afterwards
+	h.clientLock.Lock()
+	matches := []WebSocketClient{}
+	for _, client := range h.clients {
+		if filterFunc == nil || filterFunc(client.ClientGUID(), client.Attributes()) {
+			matches = append(matches, client)
+		}
+	}
+	h.clientLock.Unlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].ClientGUID() < matches[j].ClientGUID()
+	})
+
+	total = len(matches)
+	start := min(max(page.Offset, 0), total)
+	end := total
+	if page.Limit > 0 {
+		end = min(start+page.Limit, total)
+	}
+
+	clients = make([]ClientInfo, 0, end-start)
+	for _, client := range matches[start:end] {
+		clients = append(clients, newClientInfo(client))
+	}
+	return clients, total
+}
+
+func newClientInfo(client WebSocketClient) ClientInfo {
+	info := ClientInfo{
+		ClientGUID:  client.ClientGUID(),
+		Attributes:  client.Attributes().Copy(),
+		ConnectedAt: client.activity().connectedAt,
+		Pattern:     client.Handler().wsOpts.pattern,
+		Subprotocol: client.Subprotocol(),
+	}
+	if r := client.Request(); r != nil {
+		info.RemoteAddr = r.RemoteAddr
+		info.UserAgent = r.UserAgent()
+	}
+	return info
+}
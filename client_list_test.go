@@ -0,0 +1,48 @@
+package uwebsocket
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListClients(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	h, c1, _ := createTestSetup(t, ctx)
+	c1.r = httptest.NewRequest("GET", "/ws", nil)
+	c1.r.Header.Set("User-Agent", "test-agent")
+
+	clients, total := h.ListClients(nil, Pagination{})
+	require.Equal(t, 2, total)
+	require.Len(t, clients, 2)
+	require.Equal(t, testClientGUID1, clients[0].ClientGUID)
+	require.Equal(t, testClientGUID2, clients[1].ClientGUID)
+	require.Equal(t, "test-agent", clients[0].UserAgent)
+	require.Equal(t, c1.r.RemoteAddr, clients[0].RemoteAddr)
+	require.False(t, clients[0].ConnectedAt.IsZero())
+
+	// changing the snapshot does not affect the client
+	clients[0].Attributes.SetString(testClientKey, "changed")
+	require.True(t, c1.Attributes().HasMatch(testClientKey, testClient1Value))
+
+	// filter
+	clients, total = h.ListClients(func(clientGUID string, attrs *ClientAttributes) bool {
+		return attrs.IsFlagSet(testClientFlag)
+	}, Pagination{})
+	require.Equal(t, 1, total)
+	require.Equal(t, testClientGUID1, clients[0].ClientGUID)
+
+	// pagination
+	clients, total = h.ListClients(nil, Pagination{Offset: 1, Limit: 1})
+	require.Equal(t, 2, total)
+	require.Len(t, clients, 1)
+	require.Equal(t, testClientGUID2, clients[0].ClientGUID)
+
+	clients, total = h.ListClients(nil, Pagination{Offset: 5})
+	require.Equal(t, 2, total)
+	require.Empty(t, clients)
+}
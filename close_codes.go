@@ -0,0 +1,13 @@
+package uwebsocket
+
+// Close codes sent by the hub (from the range reserved for applications)
+const (
+	// The client could not keep up with its messages
+	CloseSlowConsumer = 4008
+	// Another client with the same GUID connected (see ClientIDCollisionPolicy)
+	CloseDuplicateClientID = 4009
+	// The client was disconnected by an operator (see AdminHandler)
+	CloseKicked = 4010
+	// The client was inactive for longer than its IdleTimeout
+	CloseIdle = 4011
+)
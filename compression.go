@@ -0,0 +1,82 @@
+package uwebsocket
+
+import (
+	"bufio"
+	"compress/flate"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// Configuration for permessage-deflate
+type CompressionOptions struct {
+	// flate compression level, 0 uses flate.BestSpeed
+	Level int
+	// Messages smaller than this are sent uncompressed
+	MinSize int
+}
+
+func (o *CompressionOptions) level() int {
+	if o.Level == 0 {
+		return flate.BestSpeed
+	}
+	return o.Level
+}
+
+// Bytes written to clients which negotiated compression
+type CompressionStats struct {
+	// Size of the messages before compression
+	PayloadBytes int64
+	// Bytes written to the network (including websocket framing)
+	WireBytes int64
+}
+
+// WireBytes / PayloadBytes, lower is better (0 if nothing was sent yet)
+func (s CompressionStats) Ratio() float64 {
+	if s.PayloadBytes == 0 {
+		return 0
+	}
+	return float64(s.WireBytes) / float64(s.PayloadBytes)
+}
+
+// reports if the client offered permessage-deflate in the handshake
+func requestsCompression(r *http.Request) bool {
+	for _, extensions := range r.Header.Values("Sec-Websocket-Extensions") {
+		if strings.Contains(extensions, "permessage-deflate") {
+			return true
+		}
+	}
+	return false
+}
+
+// countingConn counts the bytes written to the network
+type countingConn struct {
+	net.Conn
+	written *atomic.Int64
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.written.Add(int64(n))
+	return n, err
+}
+
+// countingResponseWriter makes the upgrader use a countingConn when hijacking the connection
+type countingResponseWriter struct {
+	http.ResponseWriter
+	written *atomic.Int64
+}
+
+func (w *countingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not implement http.Hijacker")
+	}
+	conn, brw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &countingConn{Conn: conn, written: w.written}, brw, nil
+}
@@ -0,0 +1,60 @@
+package uwebsocket
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressionStats(t *testing.T) {
+	hub := &webSocketHub{messageType: websocket.TextMessage, stats: newHubStats(), clientLock: &sync.Mutex{}}
+	handler := NewHandler(WithCompression(CompressionOptions{MinSize: 100}))
+
+	clients := make(chan *webSocketClient)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !requestsCompression(r) {
+			t.Error("compression was not requested")
+		}
+		wireBytes := &atomic.Int64{}
+		upgrader := websocket.Upgrader{EnableCompression: true}
+		conn, err := upgrader.Upgrade(&countingResponseWriter{ResponseWriter: w, written: wireBytes}, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		wireBytes.Store(0)
+		clients <- &webSocketClient{hub: hub, conn: conn, handler: handler, wireBytes: wireBytes, activityStats: newClientActivity()}
+	}))
+	defer server.Close()
+
+	peer, _, err := (&websocket.Dialer{EnableCompression: true}).Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer peer.Close()
+	client := <-clients
+	defer client.conn.Close()
+
+	// below MinSize: sent uncompressed
+	require.NoError(t, client.write([]*queuedMessage{{payload: message1}}))
+	_, received, err := peer.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, message1, received)
+	require.Greater(t, hub.CompressionStats().Ratio(), 1.0)
+
+	payload := bytes.Repeat([]byte("compress me "), 1000)
+	require.NoError(t, client.write([]*queuedMessage{{payload: payload}}))
+	_, received, err = peer.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, payload, received)
+
+	stats := hub.CompressionStats()
+	require.Equal(t, int64(len(message1)+len(payload)), stats.PayloadBytes)
+	require.Less(t, stats.Ratio(), 0.1)
+	require.Equal(t, stats, hub.Stats().Compression)
+}
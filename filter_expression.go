@@ -0,0 +1,73 @@
+package uwebsocket
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Key of a filter expression which refers to the GUID of the client instead of an attribute
+const FilterKeyClientGUID = "clientGUID"
+
+// Parses a filter expression into a filter for Send, CountClientsWithFilter and ListClients.
+// An expression consists of conditions separated by commas, all of them have to match:
+//   - key=value: the string attribute is set to the value
+//   - key!=value: the string attribute is not set to the value
+//   - key: the bool attribute is set to true
+//   - !key: the bool attribute is not set to true
+//
+// The key clientGUID refers to the GUID of the client. An empty expression matches all clients.
+func ParseFilter(expression string) (func(clientGUID string, attrs *ClientAttributes) bool, error) {
+	conditions := []func(clientGUID string, attrs *ClientAttributes) bool{}
+	for _, condition := range strings.Split(expression, ",") {
+		condition = strings.TrimSpace(condition)
+		if condition == "" {
+			continue
+		}
+		parsed, err := parseCondition(condition)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, parsed)
+	}
+
+	return func(clientGUID string, attrs *ClientAttributes) bool {
+		for _, condition := range conditions {
+			if !condition(clientGUID, attrs) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+func parseCondition(condition string) (func(clientGUID string, attrs *ClientAttributes) bool, error) {
+	if key, value, ok := strings.Cut(condition, "!="); ok {
+		matches, err := matchCondition(key, value)
+		if err != nil {
+			return nil, err
+		}
+		return func(clientGUID string, attrs *ClientAttributes) bool { return !matches(clientGUID, attrs) }, nil
+	}
+	if key, value, ok := strings.Cut(condition, "="); ok {
+		return matchCondition(key, value)
+	}
+
+	negate := strings.HasPrefix(condition, "!")
+	key := strings.TrimSpace(strings.TrimPrefix(condition, "!"))
+	if key == "" {
+		return nil, fmt.Errorf("invalid filter condition %q: missing key", condition)
+	}
+	return func(clientGUID string, attrs *ClientAttributes) bool { return attrs.IsFlagSet(key) != negate }, nil
+}
+
+func matchCondition(key string, value string) (func(clientGUID string, attrs *ClientAttributes) bool, error) {
+	key = strings.TrimSpace(key)
+	value = strings.TrimSpace(value)
+	if key == "" {
+		return nil, fmt.Errorf("invalid filter condition %q: missing key", key+"="+value)
+	}
+	if key == FilterKeyClientGUID {
+		return func(clientGUID string, attrs *ClientAttributes) bool { return clientGUID == value }, nil
+	}
+	return func(clientGUID string, attrs *ClientAttributes) bool { return attrs.HasMatch(key, value) }, nil
+}
@@ -0,0 +1,35 @@
+package uwebsocket
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFilter(t *testing.T) {
+	attrs := NewClientAttributes().SetString("tenant", "a").SetBool("admin", true).SetBool("beta", false)
+
+	for expression, expected := range map[string]bool{
+		"":                       true,
+		"tenant=a":               true,
+		"tenant=b":               false,
+		"tenant!=b":              true,
+		"admin":                  true,
+		"beta":                   false,
+		"!beta":                  true,
+		"tenant=a, admin":        true,
+		"tenant=a,!admin":        false,
+		"clientGUID=guid1":       true,
+		"clientGUID!=guid1":      false,
+		" tenant = a , admin , ": true,
+	} {
+		filter, err := ParseFilter(expression)
+		require.NoError(t, err, expression)
+		require.Equal(t, expected, filter("guid1", attrs), expression)
+	}
+
+	for _, expression := range []string{"=a", "!", "!=a"} {
+		_, err := ParseFilter(expression)
+		require.Error(t, err, expression)
+	}
+}
@@ -18,6 +18,23 @@ type handlerOptions struct {
 	onConnect         *func(hub WebSocketHub, clientGuid string, clientAttributes *ClientAttributes, r *http.Request, ctx context.Context)
 	onError           *func(hub WebSocketHub, clientGuid string, clientAttributes *ClientAttributes, r *http.Request, err error, ctx context.Context)
 	onIncomingMessage *func(hub WebSocketHub, clientGuid string, clientAttributes *ClientAttributes, r *http.Request, msg ClientMessage, ctx context.Context)
+	overflowPolicy    OverflowPolicy
+	slowConsumer      SlowConsumerPolicy
+	onSlowConsumer    *func(hub WebSocketHub, clientGuid string, clientAttributes *ClientAttributes, r *http.Request, stats SlowConsumerStats, ctx context.Context)
+	batching          *BatchOptions
+	compression       *CompressionOptions
+	subprotocols      []Subprotocol
+	originPolicy      *OriginPolicy
+	responseHeaders   *func(hub WebSocketHub, clientGuid string, clientAttributes *ClientAttributes, r *http.Request) (http.Header, error)
+	clientGUIDHeader  string
+	clientIDGenerator *func(r *http.Request, attrs *ClientAttributes) (string, error)
+	clientIDCollision ClientIDCollisionPolicy
+	pattern           string
+	loggedAttributes  []string
+	admission         *admissionController
+	inboundRateLimit  *InboundRateLimit
+	bandwidth         *bandwidthShaper
+	idleTimeout       *IdleTimeout
 }
 type funcHandlerOption struct {
 	f func(*handlerOptions)
@@ -66,3 +83,130 @@ func WithOnIncomingMessage(f func(hub WebSocketHub, clientGuid string, clientAtt
 		o.onIncomingMessage = &f
 	})
 }
+
+// Default for what happens if the buffer of a client is full,
+// can be overridden per call using the WithOverflowPolicy SendOption
+func WithDefaultOverflowPolicy(policy OverflowPolicy) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.overflowPolicy = policy
+	})
+}
+
+// Disconnect clients (with close code CloseSlowConsumer) which cannot keep up with their messages
+func WithSlowConsumerEviction(policy SlowConsumerPolicy) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.slowConsumer = policy
+	})
+}
+
+// Called after a client was evicted, either because of WithSlowConsumerEviction or OverflowDisconnect
+func WithOnSlowConsumerEvicted(f func(hub WebSocketHub, clientGuid string, clientAttributes *ClientAttributes, r *http.Request, stats SlowConsumerStats, ctx context.Context)) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.onSlowConsumer = &f
+	})
+}
+
+// Write all queued messages (up to the configured limits) as a single frame instead of one frame per message
+func WithBatching(opts BatchOptions) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.batching = &opts
+	})
+}
+
+// Negotiate permessage-deflate with clients which support it
+func WithCompression(opts CompressionOptions) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.compression = &opts
+	})
+}
+
+// Subprotocols supported by the handler in order of preference,
+// the first one which was also requested by the client is selected
+func WithSubprotocols(subprotocols ...Subprotocol) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.subprotocols = subprotocols
+	})
+}
+
+// Only allow connections from browsers with a matching origin, overrides the hub's default
+func WithOriginPolicy(policy OriginPolicy) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.originPolicy = &policy
+	})
+}
+
+// Compute headers which are sent with the handshake response, e.g. "Set-Cookie".
+// Returning an error rejects the connection.
+func WithResponseHeaders(f func(hub WebSocketHub, clientGuid string, clientAttributes *ClientAttributes, r *http.Request) (http.Header, error)) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.responseHeaders = &f
+	})
+}
+
+// Send the GUID assigned to the client in this header of the handshake response
+func WithClientGUIDHeader(name string) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.clientGUIDHeader = name
+	})
+}
+
+// Generate the GUIDs of clients (default: random UUIDs), e.g. from a session.
+// Returning an error rejects the connection.
+func WithClientIDGenerator(f func(r *http.Request, attrs *ClientAttributes) (string, error)) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.clientIDGenerator = &f
+	})
+}
+
+// What happens if a generated GUID is already in use. Collisions are detected when registering,
+// GUIDs of a custom WithClientIDGenerator are additionally checked before upgrading (rejecting with 409 Conflict).
+func WithClientIDCollisionPolicy(policy ClientIDCollisionPolicy) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.clientIDCollision = policy
+	})
+}
+
+// Pattern the handler is registered at, added to log records of its clients.
+// Set automatically by Handle.
+func WithPattern(pattern string) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.pattern = pattern
+	})
+}
+
+// Client attributes which are added to log records of the handler's clients
+func WithLoggedAttributes(keys ...string) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.loggedAttributes = keys
+	})
+}
+
+// Limits for the connections of this handler, they apply in addition to WithHubAdmissionLimits
+func WithAdmissionLimits(limits AdmissionLimits) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.admission = newAdmissionController(limits)
+	})
+}
+
+// Limits how fast clients may send messages, see InboundAction for what happens if they exceed it
+func WithInboundRateLimit(limit InboundRateLimit) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.inboundRateLimit = &limit
+	})
+}
+
+// Limits the outbound traffic of the handler's clients, per client and per group of clients
+func WithBandwidthLimit(limit BandwidthLimit) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		o.bandwidth = newBandwidthShaper(limit)
+	})
+}
+
+// Disconnects clients which neither send nor receive application messages for a while (depending on timeout.Activity)
+func WithIdleTimeout(timeout IdleTimeout) HandlerOption {
+	return newFuncHandlerOption(func(o *handlerOptions) {
+		if timeout.Timeout > 0 {
+			o.idleTimeout = &timeout
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package uwebsocket
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type HubOption interface {
+	apply(*hubOptions)
+}
+
+type hubOptions struct {
+	logger           *slog.Logger
+	logLevels        map[LogEvent]slog.Level
+	originPolicy     *OriginPolicy
+	onOriginRejected *func(hub WebSocketHub, origin string, r *http.Request)
+	metrics          prometheus.Registerer
+
+	admission           *admissionController
+	onAdmissionRejected *func(hub WebSocketHub, rejection AdmissionRejection, r *http.Request)
+}
+
+type funcHubOption struct {
+	f func(*hubOptions)
+}
+
+func (fdo *funcHubOption) apply(do *hubOptions) {
+	fdo.f(do)
+}
+
+func newFuncHubOption(f func(*hubOptions)) *funcHubOption {
+	return &funcHubOption{f: f}
+}
+
+// Origin policy for all handlers which do not specify one with WithOriginPolicy.
+// If not set, the origins configured for CORS in uhttp are allowed (NewWebSocketHub)
+// or only same-origin connections (NewHub).
+func WithDefaultOriginPolicy(policy OriginPolicy) HubOption {
+	return newFuncHubOption(func(o *hubOptions) {
+		o.originPolicy = &policy
+	})
+}
+
+// Called for every connection attempt which was rejected because of its origin
+func WithOnOriginRejected(f func(hub WebSocketHub, origin string, r *http.Request)) HubOption {
+	return newFuncHubOption(func(o *hubOptions) {
+		o.onOriginRejected = &f
+	})
+}
+
+// Logger with format strings for diagnostics (only levels Info and above),
+// defaults to the logger of uhttp (NewWebSocketHub) or slog.Default() (NewHub)
+func WithLogger(logger Logger) HubOption {
+	return newFuncHubOption(func(o *hubOptions) {
+		o.logger = slog.New(&printfHandler{logger: logger})
+	})
+}
+
+// Structured logger for diagnostics, records of clients carry their GUID,
+// handler pattern, remote address and the attributes configured with WithLoggedAttributes
+func WithSlog(logger *slog.Logger) HubOption {
+	return newFuncHubOption(func(o *hubOptions) {
+		o.logger = logger
+	})
+}
+
+// Level for records of the event, overriding the default
+func WithLogLevel(event LogEvent, level slog.Level) HubOption {
+	return newFuncHubOption(func(o *hubOptions) {
+		if o.logLevels == nil {
+			o.logLevels = map[LogEvent]slog.Level{}
+		}
+		o.logLevels[event] = level
+	})
+}
+
+// Export prometheus metrics (namespace "uwebsocket") of the hub. To register
+// multiple hubs on the same registry, use prometheus.WrapRegistererWith.
+func WithMetrics(registerer prometheus.Registerer) HubOption {
+	return newFuncHubOption(func(o *hubOptions) {
+		o.metrics = registerer
+	})
+}
+
+// Limits for all connections of the hub, see WithAdmissionLimits for limits of a single handler
+func WithHubAdmissionLimits(limits AdmissionLimits) HubOption {
+	return newFuncHubOption(func(o *hubOptions) {
+		o.admission = newAdmissionController(limits)
+	})
+}
+
+// Called for every connection attempt which was rejected because of admission limits
+func WithOnAdmissionRejected(f func(hub WebSocketHub, rejection AdmissionRejection, r *http.Request)) HubOption {
+	return newFuncHubOption(func(o *hubOptions) {
+		o.onAdmissionRejected = &f
+	})
+}
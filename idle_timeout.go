@@ -0,0 +1,109 @@
+package uwebsocket
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// Which messages keep a connection with an IdleTimeout alive.
+// Pings, pongs and the text "PING" never do, so abandoned clients which only keep the connection open are detected.
+type IdleActivity int
+
+const (
+	// Messages received from the client
+	IdleOnIncoming IdleActivity = iota
+	// Messages sent to the client
+	IdleOnOutgoing
+	// Messages in either direction
+	IdleOnAny
+)
+
+// Disconnects clients without application messages for a while, independent of ping/pong
+type IdleTimeout struct {
+	// the client is disconnected with CloseIdle after this long without activity
+	Timeout  time.Duration
+	Activity IdleActivity
+
+	// sent this long before the timeout (if set), activity afterwards keeps the client connected
+	WarningBefore  time.Duration
+	WarningMessage []byte
+}
+
+// last activity of a client, only checked by its writePump
+type idleTracker struct {
+	timeout IdleTimeout
+
+	lastIncoming atomic.Int64
+	lastOutgoing atomic.Int64
+
+	// the last activity the warning was sent for
+	warnedFor int64
+}
+
+func newIdleTracker(timeout IdleTimeout, now time.Time) *idleTracker {
+	t := &idleTracker{timeout: timeout}
+	t.lastIncoming.Store(now.UnixNano())
+	t.lastOutgoing.Store(now.UnixNano())
+	return t
+}
+
+// warning messages do not count as activity, otherwise they would reset the timeout
+func (t *idleTracker) wrote(batch []*queuedMessage, now time.Time) {
+	for _, message := range batch {
+		if !message.keepalive {
+			t.lastOutgoing.Store(now.UnixNano())
+			return
+		}
+	}
+}
+
+func (t *idleTracker) lastActivity() int64 {
+	switch t.timeout.Activity {
+	case IdleOnOutgoing:
+		return t.lastOutgoing.Load()
+	case IdleOnAny:
+		return max(t.lastIncoming.Load(), t.lastOutgoing.Load())
+	default:
+		return t.lastIncoming.Load()
+	}
+}
+
+// returns whether to warn or disconnect the client now and when to check again
+func (t *idleTracker) check(now time.Time) (warn bool, idle bool, next time.Duration) {
+	last := t.lastActivity()
+	idleFor := now.Sub(time.Unix(0, last))
+	if idleFor >= t.timeout.Timeout {
+		return false, true, 0
+	}
+
+	if t.timeout.WarningMessage != nil && t.timeout.WarningBefore > 0 && t.warnedFor != last {
+		warnIn := t.timeout.Timeout - t.timeout.WarningBefore - idleFor
+		if warnIn > 0 {
+			return false, false, warnIn
+		}
+		t.warnedFor = last
+		warn = true
+	}
+	return warn, false, t.timeout.Timeout - idleFor
+}
+
+// warns or disconnects the client if it is idle, returns when to check again
+func (c *webSocketClient) checkIdle(ctx context.Context) time.Duration {
+	warn, idle, next := c.idle.check(time.Now())
+	if warn {
+		if discarded, _ := c.send.push(ctx, &queuedMessage{payload: c.idle.timeout.WarningMessage, priority: PriorityHigh, keepalive: true}, OverflowDropOldest); discarded {
+			c.hub.recordDrop(c, DropBufferFull)
+		}
+	}
+	if idle {
+		c.hub.clientLock.Lock()
+		closed := c.hub.closeClient(c, CloseIdle, "idle timeout", DisconnectIdle)
+		c.hub.clientLock.Unlock()
+		if closed {
+			c.hub.logClientEvent(c, LogEventIdle, "uwebsocket: disconnected idle client", slog.Duration("timeout", c.idle.timeout.Timeout))
+		}
+	}
+	return next
+}
@@ -0,0 +1,80 @@
+package uwebsocket
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdleTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	h := NewHub(websocket.TextMessage, ctx)
+	go h.Run()
+	pathAttributes := WithClientAttributes(func(hub WebSocketHub, r *http.Request) (*ClientAttributes, error) {
+		return NewClientAttributes().SetString("path", r.URL.Path), nil
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/incoming", h.HTTPHandler(NewHandler(pathAttributes, WithIdleTimeout(IdleTimeout{
+		Timeout:        time.Second,
+		WarningBefore:  500 * time.Millisecond,
+		WarningMessage: []byte("idle"),
+	}))))
+	mux.Handle("/outgoing", h.HTTPHandler(NewHandler(pathAttributes, WithIdleTimeout(IdleTimeout{
+		Timeout:  time.Second,
+		Activity: IdleOnOutgoing,
+	}))))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	dial := func(path string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+path, nil)
+		require.NoError(t, err)
+		return conn
+	}
+	read := func(conn *websocket.Conn) string {
+		_, message, err := conn.ReadMessage()
+		require.NoError(t, err)
+		return string(message)
+	}
+
+	// the client is warned, a message afterwards keeps it connected
+	start := time.Now()
+	conn := dial("/incoming")
+	defer conn.Close()
+	require.Equal(t, "idle", read(conn))
+	require.GreaterOrEqual(t, time.Since(start), 500*time.Millisecond)
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("still here")))
+
+	// text pings do not count as activity, the warning does not reset the timeout
+	start = time.Now()
+	require.Equal(t, "idle", read(conn))
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("PING")))
+	require.Equal(t, "PONG", read(conn))
+	_, _, err := conn.ReadMessage()
+	require.True(t, websocket.IsCloseError(err, CloseIdle), err)
+	require.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond)
+
+	// messages sent to the client keep it connected
+	conn = dial("/outgoing")
+	defer conn.Close()
+	start = time.Now()
+	for i := 0; i < 6; i++ {
+		h.Send(WithMessage([]byte("update")), WithMatchFilter("path", "/outgoing"))
+		require.Equal(t, "update", read(conn))
+		time.Sleep(200 * time.Millisecond)
+	}
+	_, _, err = conn.ReadMessage()
+	require.True(t, websocket.IsCloseError(err, CloseIdle), err)
+	require.GreaterOrEqual(t, time.Since(start), 2*time.Second)
+	require.Eventually(t, func() bool {
+		return h.CountClientsWithFilter(func(clientGUID string, attrs *ClientAttributes) bool { return true }) == 0
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,136 @@
+package uwebsocket
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// What happens to incoming messages of a client which exceeds its InboundRateLimit
+type InboundAction int
+
+const (
+	// The message is discarded
+	InboundDrop InboundAction = iota
+	// Reading is paused until the message fits into the limit, which slows the client down via TCP
+	InboundDelay
+	// The message is processed, but the client receives the WarningMessage
+	InboundWarn
+	// The client is disconnected with ClosePolicyViolation
+	InboundDisconnect
+)
+
+func (a InboundAction) String() string {
+	switch a {
+	case InboundDrop:
+		return "drop"
+	case InboundDelay:
+		return "delay"
+	case InboundWarn:
+		return "warn"
+	case InboundDisconnect:
+		return "disconnect"
+	default:
+		return "unknown"
+	}
+}
+
+// Limits for messages received from a single client, zero rates are unlimited
+type InboundRateLimit struct {
+	MessagesPerSecond float64
+	MessageBurst      int
+
+	BytesPerSecond float64
+	ByteBurst      int
+
+	Action InboundAction
+
+	// sent once whenever the client starts exceeding the limit (if set), regardless of the action.
+	// With InboundDisconnect it is written before the close-frame, together with everything queued before.
+	WarningMessage []byte
+}
+
+// token buckets of a client, only used by its readPump
+type inboundLimiter struct {
+	limit    InboundRateLimit
+	messages *tokenBucket
+	bytes    *tokenBucket
+
+	// if the previous message exceeded the limit
+	exceeding bool
+}
+
+func newInboundLimiter(limit InboundRateLimit) *inboundLimiter {
+	now := time.Now()
+	l := &inboundLimiter{limit: limit}
+	if limit.MessagesPerSecond > 0 {
+		l.messages = newTokenBucket(limit.MessagesPerSecond, limit.MessageBurst, now)
+	}
+	if limit.BytesPerSecond > 0 {
+		l.bytes = newTokenBucket(limit.BytesPerSecond, limit.ByteBurst, now)
+	}
+	return l
+}
+
+// takes the tokens for a message if it fits into the limit, otherwise returns how long until it does
+func (l *inboundLimiter) take(now time.Time, size int) (wait time.Duration) {
+	if l.messages != nil {
+		wait = l.messages.wait(now, 1)
+	}
+	if l.bytes != nil {
+		wait = max(wait, l.bytes.wait(now, float64(size)))
+	}
+	if wait > 0 {
+		return wait
+	}
+	if l.messages != nil {
+		l.messages.take(now, 1)
+	}
+	if l.bytes != nil {
+		l.bytes.take(now, float64(size))
+	}
+	return 0
+}
+
+// applies the inbound rate limit of the handler to a received message,
+// returns false if the message must not be processed (or reading has to stop)
+func (c *webSocketClient) limitInbound(ctx context.Context, size int) (process bool, disconnect bool) {
+	wait := c.inbound.take(time.Now(), size)
+	if wait == 0 {
+		c.inbound.exceeding = false
+		return true, false
+	}
+
+	action := c.inbound.limit.Action
+	if !c.inbound.exceeding {
+		// only report the beginning of a streak, not every single message
+		c.inbound.exceeding = true
+		c.hub.logClientEvent(c, LogEventRateLimited, "uwebsocket: client exceeded inbound rate limit", slog.String("action", action.String()))
+		if c.inbound.limit.WarningMessage != nil {
+			if discarded, _ := c.send.push(ctx, &queuedMessage{payload: c.inbound.limit.WarningMessage, priority: PriorityHigh}, OverflowDropOldest); discarded {
+				c.hub.recordDrop(c, DropBufferFull)
+			}
+		}
+	}
+	c.hub.metrics.rateLimited(c.handler.wsOpts.pattern, action)
+
+	switch action {
+	case InboundDelay:
+		for ; wait > 0; wait = c.inbound.take(time.Now(), size) {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return false, false
+			}
+		}
+		return true, false
+	case InboundWarn:
+		return true, false
+	case InboundDisconnect:
+		return false, true
+	default:
+		return false, false
+	}
+}
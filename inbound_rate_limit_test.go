@@ -0,0 +1,90 @@
+package uwebsocket
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInboundRateLimit(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	h := NewHub(websocket.TextMessage, ctx)
+	go h.Run()
+
+	processed := map[string]*atomic.Int64{}
+	mux := http.NewServeMux()
+	for path, limit := range map[string]InboundRateLimit{
+		"/drop":       {MessagesPerSecond: 0.001, MessageBurst: 2, Action: InboundDrop, WarningMessage: []byte("slow down")},
+		"/bytes":      {BytesPerSecond: 0.001, ByteBurst: 10, Action: InboundDrop},
+		"/delay":      {MessagesPerSecond: 20, MessageBurst: 1, Action: InboundDelay},
+		"/warn":       {MessagesPerSecond: 0.001, MessageBurst: 1, Action: InboundWarn, WarningMessage: []byte("slow down")},
+		"/disconnect": {MessagesPerSecond: 0.001, MessageBurst: 1, Action: InboundDisconnect, WarningMessage: []byte("goodbye")},
+	} {
+		count := &atomic.Int64{}
+		processed[path] = count
+		mux.Handle(path, h.HTTPHandler(NewHandler(
+			WithInboundRateLimit(limit),
+			WithOnIncomingMessage(func(hub WebSocketHub, clientGuid string, clientAttributes *ClientAttributes, r *http.Request, msg ClientMessage, ctx context.Context) {
+				count.Add(1)
+			}),
+		)))
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	send := func(path string, messages ...string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+path, nil)
+		require.NoError(t, err)
+		for _, message := range messages {
+			require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(message)))
+		}
+		return conn
+	}
+
+	// exceeding messages are dropped, the warning is only sent once
+	conn := send("/drop", "1", "2", "3", "4", "5")
+	defer conn.Close()
+	_, received, err := conn.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, "slow down", string(received))
+	require.Eventually(t, func() bool { return processed["/drop"].Load() == 2 }, time.Second, 10*time.Millisecond)
+
+	// a message larger than the burst passes with a full bucket
+	conn = send("/bytes", "larger than ten bytes", "12345678")
+	defer conn.Close()
+	require.Eventually(t, func() bool { return processed["/bytes"].Load() == 1 }, time.Second, 10*time.Millisecond)
+
+	// delayed messages are all processed, but slower
+	start := time.Now()
+	conn = send("/delay", "1", "2", "3", "4")
+	defer conn.Close()
+	require.Eventually(t, func() bool { return processed["/delay"].Load() == 4 }, time.Second, 10*time.Millisecond)
+	require.GreaterOrEqual(t, time.Since(start), 140*time.Millisecond)
+
+	// warned messages are processed
+	conn = send("/warn", "1", "2", "3")
+	defer conn.Close()
+	_, received, err = conn.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, "slow down", string(received))
+	require.Eventually(t, func() bool { return processed["/warn"].Load() == 3 }, time.Second, 10*time.Millisecond)
+
+	// the client is warned and disconnected
+	conn = send("/disconnect", "1", "2", "3")
+	defer conn.Close()
+	_, received, err = conn.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, "goodbye", string(received))
+	_, _, err = conn.ReadMessage()
+	require.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), err)
+	require.LessOrEqual(t, processed["/disconnect"].Load(), int64(1))
+}
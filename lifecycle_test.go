@@ -0,0 +1,123 @@
+package uwebsocket
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLifecycleWithoutLeaks(t *testing.T) {
+	for name, stop := range map[string]func(t *testing.T, h WebSocketHub, cancel context.CancelFunc){
+		"cancel": func(t *testing.T, h WebSocketHub, cancel context.CancelFunc) {
+			cancel()
+		},
+		"shutdown": func(t *testing.T, h WebSocketHub, cancel context.CancelFunc) {
+			require.NoError(t, h.Shutdown(context.Background()))
+			cancel()
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			h := NewHub(websocket.TextMessage, ctx)
+			go h.Run()
+			server := httptest.NewServer(h.HTTPHandler(NewHandler(
+				WithOnIncomingMessage(func(hub WebSocketHub, clientGuid string, clientAttributes *ClientAttributes, r *http.Request, msg ClientMessage, ctx context.Context) {
+					hub.Send(WithMessage(msg.Message), WithOverflowPolicy(OverflowBlock))
+				}),
+			)))
+			defer server.Close()
+			url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+			// clients which keep sending while the hub stops
+			for i := 0; i < 3; i++ {
+				conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+				require.NoError(t, err)
+				defer conn.Close()
+				go func() {
+					for conn.WriteMessage(websocket.TextMessage, message1) == nil {
+					}
+				}()
+			}
+			for h.CountClientsWithFilter(func(clientGUID string, attrs *ClientAttributes) bool { return true }) < 3 {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			stop(t, h, cancel)
+			waitCtx, waitCancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer waitCancel()
+			require.NoError(t, h.Wait(waitCtx))
+			requireNoLeakedGoroutines(t)
+
+			// connections are rejected once the hub stopped
+			_, response, err := websocket.DefaultDialer.Dial(url, nil)
+			require.Error(t, err)
+			require.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+		})
+	}
+}
+
+// fails if goroutines of the hub or its clients are still running after a grace period
+func requireNoLeakedGoroutines(t *testing.T) {
+	leaked := ""
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		leaked = ""
+		buf := make([]byte, 1<<20)
+		for _, goroutine := range strings.Split(string(buf[:runtime.Stack(buf, true)]), "\n\n") {
+			if strings.Contains(goroutine, "uwebsocket.(*webSocketClient)") || strings.Contains(goroutine, "uwebsocket.(*webSocketHub).Run") {
+				leaked += goroutine + "\n\n"
+			}
+		}
+		if leaked == "" {
+			return
+		}
+	}
+	t.Fatalf("leaked goroutines:\n%s", leaked)
+}
+
+func TestWaitWhileClientsConnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h := NewHub(websocket.TextMessage, ctx)
+	go h.Run()
+	server := httptest.NewServer(h.HTTPHandler(NewHandler()))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for start := time.Now(); time.Since(start) < 300*time.Millisecond; {
+			if conn, _, err := websocket.DefaultDialer.Dial(url, nil); err == nil {
+				conn.Close()
+			}
+		}
+	}()
+
+	// waiting (and timing out) while pumps are started and stopped
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		waitCtx, waitCancel := context.WithTimeout(ctx, 5*time.Millisecond)
+		_ = h.Wait(waitCtx)
+		waitCancel()
+	}
+
+	cancel()
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer waitCancel()
+	require.NoError(t, h.Wait(waitCtx))
+	requireNoLeakedGoroutines(t)
+}
@@ -0,0 +1,165 @@
+package uwebsocket
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Logger with format strings, the logger of uhttp satisfies it
+type Logger interface {
+	Infof(format string, v ...interface{})
+	Errorf(format string, v ...interface{})
+}
+
+// Kinds of records logged by the hub, the level of each can be configured with WithLogLevel
+type LogEvent string
+
+const (
+	// A client connected
+	LogEventConnect LogEvent = "connect"
+	// A client disconnected
+	LogEventDisconnect LogEvent = "disconnect"
+	// Reading from or writing to a client failed (only if no WithOnError callback is configured)
+	LogEventClientError LogEvent = "clientError"
+	// The buffer of a client overflowed
+	LogEventBufferFull LogEvent = "bufferFull"
+	// A slow consumer was evicted
+	LogEventSlowConsumer LogEvent = "slowConsumer"
+	// A connection was rejected because of its origin
+	LogEventOriginRejected LogEvent = "originRejected"
+	// A client connected with a GUID which was already in use
+	LogEventDuplicateClient LogEvent = "duplicateClient"
+	// Generating a message (or welcome message) failed
+	LogEventMessageError LogEvent = "messageError"
+	// A handler was registered
+	LogEventHandle LogEvent = "handle"
+	// A connection was rejected because of admission limits
+	LogEventAdmissionRejected LogEvent = "admissionRejected"
+	// A client exceeded its inbound rate limit
+	LogEventRateLimited LogEvent = "rateLimited"
+	// A client was disconnected because of its idle timeout
+	LogEventIdle LogEvent = "idle"
+	// An operator sent a message or kicked clients through the AdminHandler
+	LogEventAdmin LogEvent = "admin"
+)
+
+var defaultLogLevels = map[LogEvent]slog.Level{
+	LogEventConnect:           slog.LevelDebug,
+	LogEventDisconnect:        slog.LevelDebug,
+	LogEventClientError:       slog.LevelError,
+	LogEventBufferFull:        slog.LevelWarn,
+	LogEventSlowConsumer:      slog.LevelWarn,
+	LogEventOriginRejected:    slog.LevelWarn,
+	LogEventDuplicateClient:   slog.LevelWarn,
+	LogEventMessageError:      slog.LevelError,
+	LogEventHandle:            slog.LevelInfo,
+	LogEventAdmin:             slog.LevelInfo,
+	LogEventAdmissionRejected: slog.LevelWarn,
+	LogEventRateLimited:       slog.LevelWarn,
+	LogEventIdle:              slog.LevelInfo,
+}
+
+func (o hubOptions) logLevel(event LogEvent) slog.Level {
+	if level, ok := o.logLevels[event]; ok {
+		return level
+	}
+	return defaultLogLevels[event]
+}
+
+// logs an event which is not related to a single client
+func (h *webSocketHub) logEvent(event LogEvent, msg string, attrs ...slog.Attr) {
+	ctx := context.Background()
+	level := h.opts.logLevel(event)
+	if !h.logger.Enabled(ctx, level) {
+		return
+	}
+	h.logger.LogAttrs(ctx, level, msg, append([]slog.Attr{slog.String("event", string(event))}, attrs...)...)
+}
+
+// logs an event of a client, adding its GUID, handler pattern, remote address and the attributes configured with WithLoggedAttributes
+func (h *webSocketHub) logClientEvent(client WebSocketClient, event LogEvent, msg string, attrs ...slog.Attr) {
+	ctx := context.Background()
+	level := h.opts.logLevel(event)
+	if !h.logger.Enabled(ctx, level) {
+		return
+	}
+
+	clientAttrs := []slog.Attr{
+		slog.String("event", string(event)),
+		slog.String("clientGuid", client.ClientGUID()),
+	}
+	if pattern := client.Handler().wsOpts.pattern; pattern != "" {
+		clientAttrs = append(clientAttrs, slog.String("pattern", pattern))
+	}
+	if r := client.Request(); r != nil {
+		clientAttrs = append(clientAttrs, slog.String("remoteAddr", r.RemoteAddr))
+	}
+	if keys := client.Handler().wsOpts.loggedAttributes; len(keys) > 0 && client.Attributes() != nil {
+		clientAttrs = append(clientAttrs, slog.Any("attributes", client.Attributes().subset(keys...)))
+	}
+	h.logger.LogAttrs(ctx, level, msg, append(clientAttrs, attrs...)...)
+}
+
+// printfHandler writes slog records to a Logger as "msg key=value ..."
+type printfHandler struct {
+	logger Logger
+	attrs  []slog.Attr
+	group  string
+}
+
+func (p *printfHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelInfo
+}
+
+func (p *printfHandler) Handle(ctx context.Context, record slog.Record) error {
+	out := []string{record.Message}
+	for _, attr := range p.attrs {
+		out = appendAttr(out, "", attr)
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		out = appendAttr(out, p.group, attr)
+		return true
+	})
+
+	if record.Level >= slog.LevelWarn {
+		p.logger.Errorf("%s", strings.Join(out, " "))
+	} else {
+		p.logger.Infof("%s", strings.Join(out, " "))
+	}
+	return nil
+}
+
+func (p *printfHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	prefixed := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		prefixed[i] = slog.Attr{Key: joinKey(p.group, attr.Key), Value: attr.Value}
+	}
+	return &printfHandler{logger: p.logger, attrs: append(append([]slog.Attr{}, p.attrs...), prefixed...), group: p.group}
+}
+
+func (p *printfHandler) WithGroup(name string) slog.Handler {
+	return &printfHandler{logger: p.logger, attrs: p.attrs, group: joinKey(p.group, name)}
+}
+
+func appendAttr(out []string, group string, attr slog.Attr) []string {
+	value := attr.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		for _, groupAttr := range value.Group() {
+			out = appendAttr(out, joinKey(group, attr.Key), groupAttr)
+		}
+		return out
+	}
+	return append(out, fmt.Sprintf("%s=%v", joinKey(group, attr.Key), value.Any()))
+}
+
+func joinKey(group string, key string) string {
+	if group == "" {
+		return key
+	}
+	if key == "" {
+		return group
+	}
+	return group + "." + key
+}
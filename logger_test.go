@@ -0,0 +1,62 @@
+package uwebsocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStructuredLogging(t *testing.T) {
+	buf := &bytes.Buffer{}
+	h := NewHub(websocket.TextMessage, context.Background(),
+		WithSlog(slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))),
+		WithLogLevel(LogEventBufferFull, slog.LevelError),
+	).(*webSocketHub)
+
+	client := NewWebSocketClientMock(t, context.Background(), testClientGUID1, NewClientAttributes().SetString("tenant", "a").SetString("secret", "b"))
+	client.handler = NewHandler(WithPattern("/ws"), WithLoggedAttributes("tenant"))
+	client.r = httptest.NewRequest("GET", "/ws", nil)
+	h.logClientEvent(client, LogEventBufferFull, "buffer full", slog.String("policy", OverflowDrop.String()))
+
+	record := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	require.Equal(t, "ERROR", record["level"])
+	require.Equal(t, "bufferFull", record["event"])
+	require.Equal(t, testClientGUID1, record["clientGuid"])
+	require.Equal(t, "/ws", record["pattern"])
+	require.Equal(t, "192.0.2.1:1234", record["remoteAddr"])
+	require.Equal(t, map[string]interface{}{"tenant": "a"}, record["attributes"])
+	require.Equal(t, "drop", record["policy"])
+}
+
+type testLogger struct {
+	infos  []string
+	errors []string
+}
+
+func (l *testLogger) Infof(format string, v ...interface{}) {
+	l.infos = append(l.infos, fmt.Sprintf(format, v...))
+}
+
+func (l *testLogger) Errorf(format string, v ...interface{}) {
+	l.errors = append(l.errors, fmt.Sprintf(format, v...))
+}
+
+func TestPrintfLogging(t *testing.T) {
+	logger := &testLogger{}
+	h := NewHub(websocket.TextMessage, context.Background(), WithLogger(logger)).(*webSocketHub)
+
+	h.logEvent(LogEventHandle, "registered", slog.String("pattern", "/ws"))
+	h.logEvent(LogEventOriginRejected, "rejected", slog.Group("request", slog.String("origin", "https://evil.com")))
+	h.logEvent(LogEventConnect, "connected")
+
+	require.Equal(t, []string{"registered event=handle pattern=/ws"}, logger.infos)
+	require.Equal(t, []string{"rejected event=originRejected request.origin=https://evil.com"}, logger.errors)
+}
@@ -0,0 +1,207 @@
+package uwebsocket
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Why a client was removed from the hub
+type DisconnectReason string
+
+const (
+	// The connection was closed by the client or failed
+	DisconnectClosed DisconnectReason = "closed"
+	// The client could not keep up with its messages
+	DisconnectSlowConsumer DisconnectReason = "slowConsumer"
+	// Another client with the same GUID replaced it (or it was rejected)
+	DisconnectDuplicateClient DisconnectReason = "duplicateClient"
+	// The hub was stopped
+	DisconnectShutdown DisconnectReason = "shutdown"
+	// An operator disconnected the client
+	DisconnectKicked DisconnectReason = "kicked"
+	// The client exceeded its inbound rate limit (InboundDisconnect)
+	DisconnectRateLimited DisconnectReason = "rateLimited"
+	// The client was inactive for longer than its IdleTimeout
+	DisconnectIdle DisconnectReason = "idle"
+)
+
+// prometheus collectors of a hub, all methods are no-ops on a nil receiver
+type metrics struct {
+	activeConnections *prometheus.GaugeVec
+	connects          *prometheus.CounterVec
+	disconnects       *prometheus.CounterVec
+	messagesIn        *prometheus.CounterVec
+	messagesOut       *prometheus.CounterVec
+	bytesIn           *prometheus.CounterVec
+	bytesOut          *prometheus.CounterVec
+	drops             *prometheus.CounterVec
+	queueDepth        *prometheus.HistogramVec
+	sendFanout        prometheus.Histogram
+	sendLatency       prometheus.Histogram
+	pingRTT           *prometheus.HistogramVec
+	rejections        *prometheus.CounterVec
+	inboundLimited    *prometheus.CounterVec
+	throttledSeconds  *prometheus.CounterVec
+}
+
+func newMetrics(registerer prometheus.Registerer) (*metrics, error) {
+	const namespace = "uwebsocket"
+	m := &metrics{
+		activeConnections: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace, Name: "active_connections", Help: "Currently connected clients.",
+		}, []string{"pattern"}),
+		connects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "connects_total", Help: "Clients which connected.",
+		}, []string{"pattern"}),
+		disconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "disconnects_total", Help: "Clients which disconnected by reason.",
+		}, []string{"pattern", "reason"}),
+		messagesIn: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "messages_received_total", Help: "Messages received from clients.",
+		}, []string{"pattern"}),
+		messagesOut: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "messages_sent_total", Help: "Messages written to clients.",
+		}, []string{"pattern"}),
+		bytesIn: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "bytes_received_total", Help: "Payload bytes received from clients.",
+		}, []string{"pattern"}),
+		bytesOut: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "bytes_sent_total", Help: "Payload bytes written to clients.",
+		}, []string{"pattern"}),
+		drops: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "messages_dropped_total", Help: "Messages which were not delivered by cause.",
+		}, []string{"pattern", "cause"}),
+		queueDepth: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Name: "send_queue_depth", Help: "Messages in the send-buffer of a client after enqueueing.",
+			Buckets: []float64{0, 1, 2, 4, 8, 16, 32, 64, 128, 256},
+		}, []string{"pattern"}),
+		sendFanout: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace, Name: "send_fanout", Help: "Clients matching the filter of a Send.",
+			Buckets: prometheus.ExponentialBuckets(1, 4, 9),
+		}),
+		sendLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace, Name: "send_duration_seconds", Help: "Duration of Send (filtering, generating and enqueueing).",
+			Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10),
+		}),
+		pingRTT: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Name: "ping_rtt_seconds", Help: "Round-trip time of websocket pings.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+		}, []string{"pattern"}),
+		rejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "admission_rejections_total", Help: "Connections which were rejected by admission limits.",
+		}, []string{"pattern", "reason"}),
+		inboundLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "inbound_rate_limited_total", Help: "Received messages which exceeded the inbound rate limit by action.",
+		}, []string{"pattern", "action"}),
+		throttledSeconds: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "outbound_throttled_seconds_total", Help: "Time clients waited for outbound bandwidth budget.",
+		}, []string{"pattern"}),
+	}
+
+	collectors := []prometheus.Collector{
+		m.activeConnections, m.connects, m.disconnects, m.messagesIn, m.messagesOut, m.bytesIn,
+		m.bytesOut, m.drops, m.queueDepth, m.sendFanout, m.sendLatency, m.pingRTT, m.rejections,
+		m.inboundLimited, m.throttledSeconds,
+	}
+	for i, collector := range collectors {
+		if err := registerer.Register(collector); err != nil {
+			// do not leave collectors behind which are never updated
+			for _, registered := range collectors[:i] {
+				registerer.Unregister(registered)
+			}
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *metrics) connected(pattern string) {
+	if m == nil {
+		return
+	}
+	m.activeConnections.WithLabelValues(pattern).Inc()
+	m.connects.WithLabelValues(pattern).Inc()
+}
+
+func (m *metrics) disconnected(pattern string, reason DisconnectReason) {
+	if m == nil {
+		return
+	}
+	m.activeConnections.WithLabelValues(pattern).Dec()
+	m.disconnects.WithLabelValues(pattern, string(reason)).Inc()
+}
+
+// a client which was never counted as connected
+func (m *metrics) refused(pattern string, reason DisconnectReason) {
+	if m == nil {
+		return
+	}
+	m.disconnects.WithLabelValues(pattern, string(reason)).Inc()
+}
+
+func (m *metrics) received(pattern string, bytes int) {
+	if m == nil {
+		return
+	}
+	m.messagesIn.WithLabelValues(pattern).Inc()
+	m.bytesIn.WithLabelValues(pattern).Add(float64(bytes))
+}
+
+func (m *metrics) sent(pattern string, messages int, bytes int) {
+	if m == nil {
+		return
+	}
+	m.messagesOut.WithLabelValues(pattern).Add(float64(messages))
+	m.bytesOut.WithLabelValues(pattern).Add(float64(bytes))
+}
+
+func (m *metrics) dropped(pattern string, cause DropCause) {
+	if m == nil {
+		return
+	}
+	m.drops.WithLabelValues(pattern, string(cause)).Inc()
+}
+
+func (m *metrics) queued(pattern string, depth int) {
+	if m == nil {
+		return
+	}
+	m.queueDepth.WithLabelValues(pattern).Observe(float64(depth))
+}
+
+func (m *metrics) sendDone(fanout int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.sendFanout.Observe(float64(fanout))
+	m.sendLatency.Observe(duration.Seconds())
+}
+
+func (m *metrics) ping(pattern string, rtt time.Duration) {
+	if m == nil {
+		return
+	}
+	m.pingRTT.WithLabelValues(pattern).Observe(rtt.Seconds())
+}
+
+func (m *metrics) rejected(pattern string, rejection AdmissionRejection) {
+	if m == nil {
+		return
+	}
+	m.rejections.WithLabelValues(pattern, string(rejection)).Inc()
+}
+
+func (m *metrics) rateLimited(pattern string, action InboundAction) {
+	if m == nil {
+		return
+	}
+	m.inboundLimited.WithLabelValues(pattern, action.String()).Inc()
+}
+
+func (m *metrics) throttled(pattern string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.throttledSeconds.WithLabelValues(pattern).Add(duration.Seconds())
+}
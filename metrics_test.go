@@ -0,0 +1,96 @@
+package uwebsocket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	registry := prometheus.NewRegistry()
+	h, _, _ := createTestSetup(t, ctx, WithMetrics(registry))
+
+	require.Equal(t, float64(2), gatheredValue(t, registry, "uwebsocket_active_connections", nil))
+	require.Equal(t, float64(2), gatheredValue(t, registry, "uwebsocket_connects_total", nil))
+
+	// a rejected duplicate was never connected
+	rejected := NewWebSocketClientMock(t, ctx, testClientGUID1, NewClientAttributes())
+	h.register <- rejected
+	require.Eventually(t, func() bool { return rejected.calledRun.Load() }, time.Second, 10*time.Millisecond)
+	require.Equal(t, float64(2), gatheredValue(t, registry, "uwebsocket_active_connections", nil))
+	require.Equal(t, float64(1), gatheredValue(t, registry, "uwebsocket_disconnects_total", map[string]string{"reason": string(DisconnectDuplicateClient)}))
+
+	// the buffer of client 1 overflows once
+	for i := 0; i < 4; i++ {
+		h.Send(WithMessage(message1), WithClientFilter(testClientGUID1))
+	}
+	require.Equal(t, float64(1), gatheredValue(t, registry, "uwebsocket_messages_dropped_total", map[string]string{"cause": string(DropBufferFull)}))
+	require.Equal(t, float64(3), gatheredValue(t, registry, "uwebsocket_send_queue_depth", nil))
+	require.Equal(t, float64(4), gatheredValue(t, registry, "uwebsocket_send_fanout", nil))
+
+	// a blocking send which times out is counted separately
+	blockCtx, blockCancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer blockCancel()
+	require.Error(t, h.SendCtx(blockCtx, WithMessage(message1), WithClientFilter(testClientGUID1), WithOverflowPolicy(OverflowBlock)))
+	require.Equal(t, float64(1), gatheredValue(t, registry, "uwebsocket_messages_dropped_total", map[string]string{"cause": string(DropTimeout)}))
+
+	// making room by dropping the oldest message is an overflow, not a timeout
+	require.NoError(t, h.SendCtx(ctx, WithMessage(message1), WithClientFilter(testClientGUID1), WithOverflowPolicy(OverflowDropOldest)))
+	require.Equal(t, float64(2), gatheredValue(t, registry, "uwebsocket_messages_dropped_total", map[string]string{"cause": string(DropBufferFull)}))
+	require.Equal(t, float64(1), gatheredValue(t, registry, "uwebsocket_messages_dropped_total", map[string]string{"cause": string(DropTimeout)}))
+
+	// client 2 is evicted
+	for i := 0; i < 4; i++ {
+		h.Send(WithMessage(message1), WithClientFilter(testClientGUID2), WithOverflowPolicy(OverflowDisconnect))
+	}
+	require.Equal(t, float64(1), gatheredValue(t, registry, "uwebsocket_active_connections", nil))
+	require.Equal(t, float64(1), gatheredValue(t, registry, "uwebsocket_disconnects_total", map[string]string{"reason": string(DisconnectSlowConsumer)}))
+
+	// a second hub cannot register the same collectors, it runs without metrics
+	require.Nil(t, NewHub(1, ctx, WithMetrics(registry)).(*webSocketHub).metrics)
+
+	// collectors registered before a conflict are removed again
+	registry = prometheus.NewRegistry()
+	conflicting := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "uwebsocket", Name: "outbound_throttled_seconds_total", Help: "Time clients waited for outbound bandwidth budget.",
+	}, []string{"pattern"})
+	require.NoError(t, registry.Register(conflicting))
+	require.Nil(t, NewHub(1, ctx, WithMetrics(registry)).(*webSocketHub).metrics)
+	require.True(t, registry.Unregister(conflicting))
+	require.NotNil(t, NewHub(1, ctx, WithMetrics(registry)).(*webSocketHub).metrics)
+}
+
+// returns the value of a counter or gauge (or the sample count of a histogram) summed over all matching series
+func gatheredValue(t *testing.T, registry *prometheus.Registry, name string, labels map[string]string) float64 {
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	value := float64(0)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if expected, ok := labels[label.GetName()]; ok && expected != label.GetValue() {
+					continue metrics
+				}
+			}
+			switch {
+			case metric.Counter != nil:
+				value += metric.GetCounter().GetValue()
+			case metric.Gauge != nil:
+				value += metric.GetGauge().GetValue()
+			case metric.Histogram != nil:
+				value += float64(metric.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	return value
+}
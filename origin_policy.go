@@ -0,0 +1,99 @@
+package uwebsocket
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Decides if a websocket connection from the browser origin (Origin header) is allowed.
+// Requests without an Origin header do not come from browsers and are not checked.
+type OriginPolicy func(origin string, r *http.Request) bool
+
+// Allows the exact origins, e.g. "https://app.example.com", "*" allows all origins
+func AllowOrigins(origins ...string) OriginPolicy {
+	allowed := map[string]bool{}
+	for _, origin := range origins {
+		allowed[normalizeOrigin(origin)] = true
+	}
+	return func(origin string, r *http.Request) bool {
+		return allowed["*"] || allowed[normalizeOrigin(origin)]
+	}
+}
+
+// Allows origins matching one of the patterns, where a "*" replaces any number
+// of subdomains, e.g. "https://*.example.com" allows "https://a.b.example.com"
+// but not "https://example.com"
+func AllowOriginPatterns(patterns ...string) OriginPolicy {
+	normalized := make([]string, len(patterns))
+	for i := range patterns {
+		normalized[i] = normalizeOrigin(patterns[i])
+	}
+	return func(origin string, r *http.Request) bool {
+		origin = normalizeOrigin(origin)
+		for _, pattern := range normalized {
+			if matchOriginPattern(pattern, origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Allows origins matching the regular expression
+func AllowOriginRegexp(re *regexp.Regexp) OriginPolicy {
+	return func(origin string, r *http.Request) bool {
+		return re.MatchString(origin)
+	}
+}
+
+// Allows origins with the same host as the request (the default of gorilla/websocket)
+func AllowSameOrigin() OriginPolicy {
+	return func(origin string, r *http.Request) bool {
+		u, err := url.Parse(origin)
+		if err != nil {
+			return false
+		}
+		return strings.EqualFold(u.Host, r.Host)
+	}
+}
+
+// the comma-separated list of allowed origins (or "*") configured for CORS.
+// Before policies could be configured, the entries were compared with the Host of the request,
+// now they are compared with its Origin header: entries like "app.example.com" have to become
+// "https://app.example.com". The list is only parsed again when the CORS config changes.
+func corsOriginPolicy(cors func() string) OriginPolicy {
+	var lock sync.Mutex
+	var parsedFor string
+	var policy OriginPolicy
+	return func(origin string, r *http.Request) bool {
+		current := cors()
+		lock.Lock()
+		if policy == nil || current != parsedFor {
+			parsedFor = current
+			policy = AllowOrigins(strings.Split(current, ",")...)
+		}
+		allowed := policy
+		lock.Unlock()
+		return allowed(origin, r)
+	}
+}
+
+func normalizeOrigin(origin string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+}
+
+func matchOriginPattern(pattern string, origin string) bool {
+	prefix, suffix, wildcard := strings.Cut(pattern, "*")
+	if !wildcard {
+		return pattern == origin
+	}
+	if !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) || len(origin) <= len(prefix)+len(suffix) {
+		return false
+	}
+	// the wildcard may only stand for subdomains
+	subdomains := origin[len(prefix) : len(origin)-len(suffix)]
+	return !strings.ContainsAny(subdomains, "/:@?#")
+}
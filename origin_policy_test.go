@@ -0,0 +1,84 @@
+package uwebsocket
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/dunv/uhttp"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOriginPolicies(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+
+	exact := AllowOrigins("https://app.example.com", "http://localhost:3000/")
+	require.True(t, exact("https://app.example.com", r))
+	require.True(t, exact("HTTPS://APP.EXAMPLE.COM", r))
+	require.True(t, exact("http://localhost:3000", r))
+	require.False(t, exact("http://app.example.com", r))
+	require.False(t, exact("https://evil.com", r))
+	require.True(t, AllowOrigins("*")("https://evil.com", r))
+
+	patterns := AllowOriginPatterns("https://*.example.com")
+	require.True(t, patterns("https://app.example.com", r))
+	require.True(t, patterns("https://a.b.example.com", r))
+	require.False(t, patterns("https://example.com", r))
+	require.False(t, patterns("https://evil.com/.example.com", r))
+	require.False(t, patterns("https://app.example.com.evil.com", r))
+
+	re := AllowOriginRegexp(regexp.MustCompile(`^https://(app|admin)\.example\.com$`))
+	require.True(t, re("https://admin.example.com", r))
+	require.False(t, re("https://other.example.com", r))
+}
+
+func TestCORSOriginPolicy(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	cors := "https://app.example.com,https://admin.example.com"
+	policy := corsOriginPolicy(func() string { return cors })
+
+	require.True(t, policy("https://admin.example.com", r))
+	require.False(t, policy("https://evil.com", r))
+	// entries are compared with the origin, not the host of the request
+	require.False(t, corsOriginPolicy(func() string { return "example.com" })("https://example.com", r))
+
+	// changes of the config are picked up
+	cors = "https://evil.com"
+	require.True(t, policy("https://evil.com", r))
+	require.False(t, policy("https://admin.example.com", r))
+	cors = "*"
+	require.True(t, policy("https://other.com", r))
+}
+
+func TestCheckOrigin(t *testing.T) {
+	rejected := []string{}
+	h := NewWebSocketHub(uhttp.NewUHTTP(), websocket.TextMessage, context.Background(),
+		WithDefaultOriginPolicy(AllowOrigins("https://app.example.com")),
+		WithOnOriginRejected(func(hub WebSocketHub, origin string, r *http.Request) {
+			rejected = append(rejected, origin)
+		}),
+	).(*webSocketHub)
+
+	request := func(origin string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		return r
+	}
+
+	// non-browser clients do not send an origin
+	require.True(t, h.checkOrigin(NewHandler(), request("")))
+	require.True(t, h.checkOrigin(NewHandler(), request("https://app.example.com")))
+	require.False(t, h.checkOrigin(NewHandler(), request("https://evil.com")))
+
+	// policy of the handler takes precedence
+	handler := NewHandler(WithOriginPolicy(AllowOriginPatterns("https://*.evil.com")))
+	require.True(t, h.checkOrigin(handler, request("https://www.evil.com")))
+	require.False(t, h.checkOrigin(handler, request("https://app.example.com")))
+
+	require.Equal(t, []string{"https://evil.com", "https://app.example.com"}, rejected)
+}
@@ -1,8 +1,83 @@
 package uwebsocket
 
+import (
+	"fmt"
+	"time"
+)
+
+// What to do if the send-buffer of a client is full
+type OverflowPolicy int
+
+const (
+	// Discard the new message (default)
+	OverflowDrop OverflowPolicy = iota
+	// Wait until there is space in the buffer, the client disconnects or the context is done
+	OverflowBlock
+	// Discard the oldest message in the buffer to make room for the new one
+	OverflowDropOldest
+	// Disconnect the client, it is not able to keep up
+	OverflowDisconnect
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowDrop:
+		return "drop"
+	case OverflowBlock:
+		return "block"
+	case OverflowDropOldest:
+		return "dropOldest"
+	case OverflowDisconnect:
+		return "disconnect"
+	default:
+		return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+	}
+}
+
+// Lane in the send-buffer of a client, higher lanes are written first
+type Priority int
+
+const (
+	// Default priority
+	PriorityNormal Priority = iota
+	// Written before all normal and low priority messages
+	PriorityHigh
+	// Only written if there are no high or normal priority messages (or it waited too long)
+	PriorityLow
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	case PriorityLow:
+		return "low"
+	default:
+		return fmt.Sprintf("Priority(%d)", int(p))
+	}
+}
+
+// index of the lane in the sendQueue
+func (p Priority) lane() int {
+	switch p {
+	case PriorityHigh:
+		return 0
+	case PriorityLow:
+		return 2
+	default:
+		return 1
+	}
+}
+
 type sendOptions struct {
-	messageFn func() ([]byte, error)
-	filterFn  func(clientGUID string, attrs *ClientAttributes) bool
+	messageFn      func() ([]byte, error)
+	filterFn       func(clientGUID string, attrs *ClientAttributes) bool
+	overflowPolicy *OverflowPolicy
+	conflationKey  string
+	priority       Priority
+	expiresAt      time.Time
 }
 
 type SendOption func(*sendOptions)
@@ -52,3 +127,43 @@ func WithClientFilter(clientGUID string) SendOption {
 		}
 	}
 }
+
+// Specify what happens if the buffer of a client is full.
+// Overrides the default of the handler the client connected to.
+func WithOverflowPolicy(policy OverflowPolicy) SendOption {
+	return func(o *sendOptions) {
+		o.overflowPolicy = &policy
+	}
+}
+
+// Only keep the latest message with this key in the buffer of a client:
+// if a message with the same key has not been sent yet, it is replaced instead of
+// appending a new one, so lagging clients receive the current state instead of a backlog
+func WithConflationKey(key string) SendOption {
+	return func(o *sendOptions) {
+		o.conflationKey = key
+	}
+}
+
+// Specify the lane in the send-buffer of the clients
+func WithPriority(priority Priority) SendOption {
+	return func(o *sendOptions) {
+		o.priority = priority
+	}
+}
+
+// Discard the message instead of writing it, if it is still
+// waiting in the buffer of a client after this duration
+func WithTTL(ttl time.Duration) SendOption {
+	return func(o *sendOptions) {
+		o.expiresAt = time.Now().Add(ttl)
+	}
+}
+
+// Discard the message instead of writing it, if it is still
+// waiting in the buffer of a client at this point in time
+func WithExpiresAt(expiresAt time.Time) SendOption {
+	return func(o *sendOptions) {
+		o.expiresAt = expiresAt
+	}
+}
@@ -0,0 +1,334 @@
+package uwebsocket
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var ErrBufferFull = errors.New("client buffer full")
+var ErrClientGone = errors.New("client gone")
+
+const (
+	// one lane per priority, ordered from high to low
+	numLanes = 3
+
+	// after this many messages from higher lanes, a waiting lower lane is served once
+	starvationLimit = 16
+)
+
+// a message waiting in the send-queue of a client
+type queuedMessage struct {
+	payload  []byte
+	priority Priority
+
+	// shared by all recipients of a broadcast, so framing happens only once
+	prepared *websocket.PreparedMessage
+
+	// a queued message with the same key is replaced instead of appending this one
+	conflationKey string
+
+	// the message is not written after this point in time (if set)
+	expiresAt time.Time
+
+	// not application data, does not keep a client with an IdleTimeout alive
+	keepalive bool
+
+	// sent with Send, may be combined with other messages into one frame (see WithBatching).
+	// Messages of the hub itself (e.g. PONG, warnings, welcome messages) are always written as their own frame.
+	batchable bool
+}
+
+func (m *queuedMessage) expired(now time.Time) bool {
+	return !m.expiresAt.IsZero() && now.After(m.expiresAt)
+}
+
+// sendQueue is the bounded outbound buffer of a client.
+// In contrast to a plain channel it can evict already queued messages and
+// it can be closed while producers are still enqueueing without panicking.
+// Messages are kept in one FIFO lane per priority, the capacity is shared by all lanes.
+type sendQueue struct {
+	lock     sync.Mutex
+	lanes    [numLanes][]*queuedMessage
+	size     int
+	capacity int
+	closed   bool
+
+	// the queue was closed without writing the remaining messages
+	discarded bool
+
+	// how often each lane was passed over while it had messages waiting
+	skipped [numLanes]int
+
+	// queued messages by their conflationKey
+	conflated map[string]*queuedMessage
+
+	// signals the writer that messages were added or the queue was closed
+	notify chan struct{}
+
+	// created by blocked producers, closed as soon as space becomes available
+	space chan struct{}
+
+	// payload of the close-frame sent after the last message
+	closeMessage []byte
+
+	// slow-consumer tracking
+	consecutiveDrops int
+	totalDrops       int64
+	highWaterMark    int
+	fullSince        time.Time
+	timeFull         time.Duration
+}
+
+func newSendQueue(capacity int) *sendQueue {
+	return &sendQueue{
+		capacity:  capacity,
+		conflated: map[string]*queuedMessage{},
+		notify:    make(chan struct{}, 1),
+	}
+}
+
+// push adds a message to the queue, applying the overflow-policy if the queue is full.
+// A queued message with the same conflationKey is updated in place instead, this never overflows.
+// discarded reports if a message (either the new or the oldest one) was thrown away.
+func (q *sendQueue) push(ctx context.Context, message *queuedMessage, policy OverflowPolicy) (discarded bool, err error) {
+	for {
+		q.lock.Lock()
+		if q.closed {
+			q.lock.Unlock()
+			return false, ErrClientGone
+		}
+
+		if queued, ok := q.conflated[message.conflationKey]; ok {
+			queued.payload = message.payload
+			queued.prepared = message.prepared
+			queued.expiresAt = message.expiresAt
+			q.consecutiveDrops = 0
+			q.lock.Unlock()
+			return false, nil
+		}
+
+		if q.size < q.capacity {
+			q.append(message)
+			q.consecutiveDrops = 0
+			q.trackLength()
+			q.lock.Unlock()
+			q.signal()
+			return false, nil
+		}
+
+		switch policy {
+		case OverflowDropOldest:
+			// never make room by dropping a message with a higher priority
+			q.recordDrop()
+			lane := q.lowestLane()
+			if lane < message.priority.lane() {
+				q.lock.Unlock()
+				return true, ErrBufferFull
+			}
+			q.removeFirst(lane)
+			q.append(message)
+			q.lock.Unlock()
+			q.signal()
+			return true, nil
+		case OverflowBlock:
+			if q.space == nil {
+				q.space = make(chan struct{})
+			}
+			space := q.space
+			q.lock.Unlock()
+			select {
+			case <-space:
+				continue
+			case <-ctx.Done():
+				q.lock.Lock()
+				q.recordDrop()
+				q.lock.Unlock()
+				return true, ctx.Err()
+			}
+		default:
+			q.recordDrop()
+			q.lock.Unlock()
+			return true, ErrBufferFull
+		}
+	}
+}
+
+// next returns the oldest message of the highest priority lane,
+// unless a lower lane has been passed over too often (starvation protection).
+// closed is only true once the queue was closed and all messages have been taken out.
+func (q *sendQueue) next() (message *queuedMessage, ok bool, closed bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.size == 0 {
+		return nil, false, q.closed
+	}
+
+	lane := -1
+	for i := numLanes - 1; i > 0; i-- {
+		if len(q.lanes[i]) > 0 && q.skipped[i] >= starvationLimit {
+			lane = i
+			break
+		}
+	}
+	if lane == -1 {
+		for i := range q.lanes {
+			if len(q.lanes[i]) > 0 {
+				lane = i
+				break
+			}
+		}
+	}
+	for i := lane + 1; i < numLanes; i++ {
+		if len(q.lanes[i]) > 0 {
+			q.skipped[i]++
+		}
+	}
+	q.skipped[lane] = 0
+
+	message = q.removeFirst(lane)
+	q.trackLength()
+	q.freeSpace()
+	return message, true, false
+}
+
+// close prevents further messages from being queued.
+// If discard is true, messages which have not been written yet are dropped (also if the queue was already closed),
+// discarded is the number of dropped messages.
+func (q *sendQueue) close(discard bool) (discarded int) {
+	q.lock.Lock()
+	q.closed = true
+	if discard && !q.discarded {
+		q.discarded = true
+		discarded = q.size
+		q.lanes = [numLanes][]*queuedMessage{}
+		q.size = 0
+		q.conflated = map[string]*queuedMessage{}
+	}
+	q.freeSpace()
+	q.lock.Unlock()
+	q.signal()
+	return discarded
+}
+
+// closeWithCode makes the writer send a close-frame with the given code and text.
+// If discard is true, messages which have not been written yet are dropped,
+// otherwise the close-frame follows after them.
+func (q *sendQueue) closeWithCode(code int, text string, discard bool) (discarded int) {
+	q.lock.Lock()
+	if !q.closed {
+		q.closeMessage = websocket.FormatCloseMessage(code, text)
+	}
+	q.lock.Unlock()
+	return q.close(discard)
+}
+
+// reports if the queue was closed and its remaining messages are dropped
+func (q *sendQueue) wasDiscarded() bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.discarded
+}
+
+// returns the payload of the close-frame, only valid after the queue was closed
+func (q *sendQueue) closePayload() []byte {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.closeMessage == nil {
+		return []byte{}
+	}
+	return q.closeMessage
+}
+
+func (q *sendQueue) slowConsumerStats() SlowConsumerStats {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	timeFull := q.timeFull
+	if !q.fullSince.IsZero() {
+		timeFull += time.Since(q.fullSince)
+	}
+	return SlowConsumerStats{
+		ConsecutiveDrops: q.consecutiveDrops,
+		TotalDrops:       q.totalDrops,
+		HighWaterMark:    q.highWaterMark,
+		TimeFull:         timeFull,
+	}
+}
+
+// must be called with the lock held
+func (q *sendQueue) append(message *queuedMessage) {
+	lane := message.priority.lane()
+	q.lanes[lane] = append(q.lanes[lane], message)
+	q.size++
+	if message.conflationKey != "" {
+		q.conflated[message.conflationKey] = message
+	}
+}
+
+// must be called with the lock held
+func (q *sendQueue) removeFirst(lane int) *queuedMessage {
+	message := q.lanes[lane][0]
+	q.lanes[lane][0] = nil
+	q.lanes[lane] = q.lanes[lane][1:]
+	q.size--
+	if message.conflationKey != "" {
+		delete(q.conflated, message.conflationKey)
+	}
+	return message
+}
+
+// returns the lowest priority lane which has messages, must be called with the lock held
+func (q *sendQueue) lowestLane() int {
+	for i := numLanes - 1; i >= 0; i-- {
+		if len(q.lanes[i]) > 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// must be called with the lock held
+func (q *sendQueue) recordDrop() {
+	q.consecutiveDrops++
+	q.totalDrops++
+}
+
+// updates high-water-mark and time spent full, must be called with the lock held
+func (q *sendQueue) trackLength() {
+	if q.size > q.highWaterMark {
+		q.highWaterMark = q.size
+	}
+	if q.size >= q.capacity {
+		if q.fullSince.IsZero() {
+			q.fullSince = time.Now()
+		}
+	} else if !q.fullSince.IsZero() {
+		q.timeFull += time.Since(q.fullSince)
+		q.fullSince = time.Time{}
+	}
+}
+
+func (q *sendQueue) len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.size
+}
+
+// wakes up all producers waiting for space, must be called with the lock held
+func (q *sendQueue) freeSpace() {
+	if q.space != nil {
+		close(q.space)
+		q.space = nil
+	}
+}
+
+func (q *sendQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
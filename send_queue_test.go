@@ -0,0 +1,136 @@
+package uwebsocket
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendQueueStarvation(t *testing.T) {
+	q := newSendQueue(100)
+	low := &queuedMessage{payload: message3, priority: PriorityLow}
+	_, err := q.push(context.Background(), low, OverflowDrop)
+	require.NoError(t, err)
+	for i := 0; i < 2*starvationLimit; i++ {
+		_, err := q.push(context.Background(), &queuedMessage{payload: message1, priority: PriorityHigh}, OverflowDrop)
+		require.NoError(t, err)
+	}
+
+	// low priority message is served after starvationLimit high priority messages
+	for i := 0; i < starvationLimit; i++ {
+		msg, ok, _ := q.next()
+		require.True(t, ok)
+		require.Equal(t, PriorityHigh, msg.priority)
+	}
+	msg, ok, _ := q.next()
+	require.True(t, ok)
+	require.Same(t, low, msg)
+	require.Equal(t, starvationLimit, q.len())
+}
+
+func TestSendQueueClose(t *testing.T) {
+	q := newSendQueue(1)
+	_, err := q.push(context.Background(), &queuedMessage{payload: message1}, OverflowDrop)
+	require.NoError(t, err)
+
+	// remaining messages are still written after closing
+	q.close(false)
+	_, err = q.push(context.Background(), &queuedMessage{payload: message2}, OverflowDrop)
+	require.ErrorIs(t, err, ErrClientGone)
+	msg, ok, closed := q.next()
+	require.True(t, ok)
+	require.False(t, closed)
+	require.Equal(t, message1, msg.payload)
+	_, ok, closed = q.next()
+	require.False(t, ok)
+	require.True(t, closed)
+
+	// discarding reports the dropped messages once, even if the queue was closed before
+	q = newSendQueue(2)
+	for _, message := range [][]byte{message1, message2} {
+		_, err = q.push(context.Background(), &queuedMessage{payload: message}, OverflowDrop)
+		require.NoError(t, err)
+	}
+	require.Equal(t, 0, q.close(false))
+	require.Equal(t, 2, q.close(true))
+	require.Equal(t, 0, q.close(true))
+	_, ok, closed = q.next()
+	require.False(t, ok)
+	require.True(t, closed)
+}
+
+func TestQueuedMessageExpiry(t *testing.T) {
+	now := time.Now()
+	require.False(t, (&queuedMessage{}).expired(now))
+	require.False(t, (&queuedMessage{expiresAt: now.Add(time.Second)}).expired(now))
+	require.True(t, (&queuedMessage{expiresAt: now.Add(-time.Second)}).expired(now))
+
+	// replacing a conflated message also replaces its expiry
+	q := newSendQueue(1)
+	_, err := q.push(context.Background(), &queuedMessage{payload: message1, conflationKey: "key", expiresAt: now.Add(-time.Second)}, OverflowDrop)
+	require.NoError(t, err)
+	_, err = q.push(context.Background(), &queuedMessage{payload: message2, conflationKey: "key", expiresAt: now.Add(time.Second)}, OverflowDrop)
+	require.NoError(t, err)
+	msg, ok, _ := q.next()
+	require.True(t, ok)
+	require.Equal(t, message2, msg.payload)
+	require.False(t, msg.expired(now))
+}
+
+func TestExpiredMessagesAreNotWritten(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	h := NewHub(websocket.TextMessage, ctx).(*webSocketHub)
+	go h.Run()
+
+	conns := make(chan *websocket.Conn)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conns <- conn
+	}))
+	defer server.Close()
+	peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer peer.Close()
+	conn := <-conns
+	defer conn.Close()
+
+	// the write path is driven by the test instead of a writePump
+	clientCtx, clientCancel := context.WithCancel(ctx)
+	client := &webSocketClient{
+		hub: h, conn: conn, send: newSendQueue(10), clientGUID: testClientGUID1, handler: NewHandler(),
+		ctx: clientCtx, ctxCancel: clientCancel, activityStats: newClientActivity(),
+	}
+	h.clientLock.Lock()
+	h.clients[client.clientGUID] = client
+	h.clientLock.Unlock()
+
+	h.Send(WithMessage(message1), WithTTL(20*time.Millisecond))
+	time.Sleep(30 * time.Millisecond)
+	h.Send(WithMessage(message2))
+	throttled, closed, err := client.writeQueued(ctx)
+	require.NoError(t, err)
+	require.Nil(t, throttled)
+	require.False(t, closed)
+
+	_, received, err := peer.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, message2, received)
+
+	stats := h.Stats()
+	require.Equal(t, int64(1), stats.Drops[DropExpired])
+	require.Equal(t, int64(0), stats.Drops[DropBufferFull])
+	require.Equal(t, int64(1), h.expiredMessages.Load())
+	require.Equal(t, int64(0), h.discardedMessages.Load())
+	require.Equal(t, int64(1), stats.MessagesSent)
+}
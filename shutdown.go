@@ -0,0 +1,152 @@
+package uwebsocket
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type ShutdownOption func(*shutdownOptions)
+
+type shutdownOptions struct {
+	messageFn func(closeIn time.Duration) ([]byte, error)
+	jitter    time.Duration
+}
+
+// Sends a final message to every client before it is closed, closeIn is
+// the (jittered) time until its connection is closed
+func WithShutdownMessage(messageFn func(closeIn time.Duration) ([]byte, error)) ShutdownOption {
+	return func(o *shutdownOptions) {
+		o.messageFn = messageFn
+	}
+}
+
+// Spreads closing the clients randomly over the duration, so they do not all reconnect at once
+func WithShutdownJitter(jitter time.Duration) ShutdownOption {
+	return func(o *shutdownOptions) {
+		o.jitter = jitter
+	}
+}
+
+// Shuts the hub down gracefully
+//   - new connections are rejected (503)
+//   - every client receives the shutdown message (if configured)
+//   - clients are closed with CloseGoingAway after everything queued for them was written
+//   - waits until the pumps of all clients have exited
+//
+// If ctx is done before, the remaining clients are closed immediately and its error is returned.
+func (h *webSocketHub) Shutdown(ctx context.Context, opts ...ShutdownOption) error {
+	shutdownOpts := &shutdownOptions{}
+	for _, opt := range opts {
+		opt(shutdownOpts)
+	}
+	h.shuttingDown.Store(true)
+
+	type closing struct {
+		client WebSocketClient
+		delay  time.Duration
+	}
+	h.clientLock.Lock()
+	clients := make([]closing, 0, len(h.clients))
+	for _, client := range h.clients {
+		delay := time.Duration(0)
+		if shutdownOpts.jitter > 0 {
+			delay = time.Duration(rand.Int63n(int64(shutdownOpts.jitter)))
+		}
+		clients = append(clients, closing{client: client, delay: delay})
+	}
+	h.clientLock.Unlock()
+	sort.Slice(clients, func(i, j int) bool { return clients[i].delay < clients[j].delay })
+	h.logEvent(LogEventHandle, "uwebsocket: shutting down", slog.Int("clients", len(clients)))
+
+	if shutdownOpts.messageFn != nil {
+		for _, c := range clients {
+			message, err := shutdownOpts.messageFn(c.delay)
+			if err != nil {
+				h.logClientEvent(c.client, LogEventMessageError, "uwebsocket: could not generate shutdown message", slog.Any("error", err))
+				continue
+			}
+			// make room by dropping older messages, a slow client must not delay the shutdown of the others
+			if discarded, _ := c.client.queue().push(ctx, &queuedMessage{payload: message, priority: PriorityHigh}, OverflowDropOldest); discarded {
+				h.recordDrop(c.client, DropBufferFull)
+			}
+		}
+	}
+
+	start := time.Now()
+	for _, c := range clients {
+		if wait := c.delay - time.Since(start); wait > 0 && ctx.Err() == nil {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+			}
+		}
+
+		// once ctx is done, there is no time left to write what is still queued
+		h.clientLock.Lock()
+		if registered, ok := h.clients[c.client.ClientGUID()]; ok && registered == c.client {
+			h.recordClosed(c.client, c.client.queue().closeWithCode(websocket.CloseGoingAway, "server shutting down", ctx.Err() != nil))
+			h.removeClient(c.client, false, DisconnectShutdown)
+		}
+		h.clientLock.Unlock()
+	}
+
+	return h.Wait(ctx)
+}
+
+// Waits until the goroutines of all clients have exited (i.e. after Shutdown or once the hub's context is done).
+// Returns the error of ctx if it is done before.
+func (h *webSocketHub) Wait(ctx context.Context) error {
+	select {
+	case <-h.pumps.stopped():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// counts running pumps, in contrast to a sync.WaitGroup it can be waited for while clients connect
+type pumpTracker struct {
+	lock    sync.Mutex
+	running int
+
+	// closed once no pumps are running anymore
+	idle chan struct{}
+}
+
+func (p *pumpTracker) add(n int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.running == 0 {
+		p.idle = make(chan struct{})
+	}
+	p.running += n
+}
+
+func (p *pumpTracker) done() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.running--
+	if p.running == 0 {
+		close(p.idle)
+	}
+}
+
+// returns a channel which is closed as soon as no pumps are running
+func (p *pumpTracker) stopped() <-chan struct{} {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.running == 0 {
+		idle := make(chan struct{})
+		close(idle)
+		return idle
+	}
+	return p.idle
+}
@@ -0,0 +1,60 @@
+package uwebsocket
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdown(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	h := NewHub(websocket.TextMessage, ctx)
+	go h.Run()
+	server := httptest.NewServer(h.HTTPHandler(NewHandler()))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	conns := []*websocket.Conn{}
+	for i := 0; i < 3; i++ {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+	for h.CountClientsWithFilter(func(clientGUID string, attrs *ClientAttributes) bool { return true }) < 3 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	jitter := 100 * time.Millisecond
+	require.NoError(t, h.Shutdown(ctx,
+		WithShutdownJitter(jitter),
+		WithShutdownMessage(func(closeIn time.Duration) ([]byte, error) {
+			require.Less(t, closeIn, jitter)
+			return []byte(fmt.Sprintf("reconnect in %d ms", closeIn.Milliseconds())), nil
+		}),
+	))
+	require.Equal(t, 0, h.CountClientsWithFilter(func(clientGUID string, attrs *ClientAttributes) bool { return true }))
+
+	// every client receives the message, followed by CloseGoingAway
+	for _, conn := range conns {
+		_, received, err := conn.ReadMessage()
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(string(received), "reconnect in"))
+		_, _, err = conn.ReadMessage()
+		require.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), err)
+	}
+
+	// new connections are rejected
+	_, response, err := websocket.DefaultDialer.Dial(url, nil)
+	require.Error(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+}
@@ -0,0 +1,33 @@
+package uwebsocket
+
+import "time"
+
+// Tracking information about a client which cannot keep up with its messages
+type SlowConsumerStats struct {
+	// Messages in a row which could not be queued (without dropping an older one)
+	ConsecutiveDrops int
+	// Messages dropped since the client connected
+	TotalDrops int64
+	// Highest number of messages which were queued at the same time
+	HighWaterMark int
+	// Accumulated time the buffer was completely full
+	TimeFull time.Duration
+}
+
+// Thresholds for evicting a slow consumer, zero values disable the respective check
+type SlowConsumerPolicy struct {
+	// Evict after this many messages in a row had to be dropped
+	MaxConsecutiveDrops int
+	// Evict once the buffer was full for longer than this in total
+	MaxTimeFull time.Duration
+}
+
+func (p SlowConsumerPolicy) exceeded(stats SlowConsumerStats) bool {
+	if p.MaxConsecutiveDrops > 0 && stats.ConsecutiveDrops >= p.MaxConsecutiveDrops {
+		return true
+	}
+	if p.MaxTimeFull > 0 && stats.TimeFull >= p.MaxTimeFull {
+		return true
+	}
+	return false
+}
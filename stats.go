@@ -0,0 +1,165 @@
+package uwebsocket
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Why a message was not delivered
+type DropCause string
+
+const (
+	// The send-buffer of the client was full
+	DropBufferFull DropCause = "bufferFull"
+	// The context of a blocking send was done before there was space
+	DropTimeout DropCause = "timeout"
+	// The message expired before it could be written
+	DropExpired DropCause = "expired"
+	// The client was closed before the message could be written
+	DropClosed DropCause = "closed"
+)
+
+var dropCauses = []DropCause{DropBufferFull, DropTimeout, DropExpired, DropClosed}
+
+// Snapshot of the hub, see WebSocketHub.Stats
+type Stats struct {
+	Clients          int
+	ClientsByPattern map[string]int
+	Uptime           time.Duration
+
+	MessagesSent     int64
+	MessagesReceived int64
+	BytesSent        int64
+	BytesReceived    int64
+	Drops            map[DropCause]int64
+
+	// the longest send-buffer of all connected clients
+	QueueDepth int
+	// the longest send-buffer of any client since the hub was created
+	PeakQueueDepth int
+
+	// bytes written to clients which negotiated compression, see WebSocketHub.CompressionStats
+	Compression CompressionStats
+}
+
+// Snapshot of a single client, see WebSocketHub.ClientStats
+type ClientStats struct {
+	ClientGUID  string
+	Pattern     string
+	ConnectedAt time.Time
+
+	// zero until the first message was read or written
+	LastRead  time.Time
+	LastWrite time.Time
+
+	// round-trip time of the last ping, zero until the first pong was received
+	RTT time.Duration
+
+	QueueLength  int
+	SlowConsumer SlowConsumerStats
+}
+
+// counters of the hub, safe for concurrent access
+type hubStats struct {
+	startedAt        time.Time
+	messagesSent     atomic.Int64
+	messagesReceived atomic.Int64
+	bytesSent        atomic.Int64
+	bytesReceived    atomic.Int64
+	drops            map[DropCause]*atomic.Int64
+	peakQueueDepth   atomic.Int64
+}
+
+func newHubStats() *hubStats {
+	stats := &hubStats{
+		startedAt: time.Now(),
+		drops:     map[DropCause]*atomic.Int64{},
+	}
+	for _, cause := range dropCauses {
+		stats.drops[cause] = &atomic.Int64{}
+	}
+	return stats
+}
+
+func (s *hubStats) trackQueueDepth(depth int) {
+	for {
+		peak := s.peakQueueDepth.Load()
+		if int64(depth) <= peak || s.peakQueueDepth.CompareAndSwap(peak, int64(depth)) {
+			return
+		}
+	}
+}
+
+// timestamps and measurements of a connection, updated by its pumps
+type clientActivity struct {
+	connectedAt time.Time
+
+	// unix nanoseconds
+	lastRead  atomic.Int64
+	lastWrite atomic.Int64
+
+	// nanoseconds
+	rtt atomic.Int64
+}
+
+func newClientActivity() *clientActivity {
+	return &clientActivity{connectedAt: time.Now()}
+}
+
+func unixNanoTime(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// Counters of the hub and the clients which are currently connected
+func (h *webSocketHub) Stats() Stats {
+	stats := Stats{
+		ClientsByPattern: map[string]int{},
+		Uptime:           time.Since(h.stats.startedAt),
+		MessagesSent:     h.stats.messagesSent.Load(),
+		MessagesReceived: h.stats.messagesReceived.Load(),
+		BytesSent:        h.stats.bytesSent.Load(),
+		BytesReceived:    h.stats.bytesReceived.Load(),
+		Drops:            map[DropCause]int64{},
+		PeakQueueDepth:   int(h.stats.peakQueueDepth.Load()),
+		Compression:      h.CompressionStats(),
+	}
+	for cause, count := range h.stats.drops {
+		stats.Drops[cause] = count.Load()
+	}
+
+	h.clientLock.Lock()
+	defer h.clientLock.Unlock()
+	for _, client := range h.clients {
+		stats.Clients++
+		stats.ClientsByPattern[client.Handler().wsOpts.pattern]++
+		if depth := client.queue().len(); depth > stats.QueueDepth {
+			stats.QueueDepth = depth
+		}
+	}
+	return stats
+}
+
+// Details of a connected client, returns ErrClientNotFound if there is none with the GUID
+func (h *webSocketHub) ClientStats(clientGUID string) (ClientStats, error) {
+	h.clientLock.Lock()
+	client, ok := h.clients[clientGUID]
+	h.clientLock.Unlock()
+	if !ok {
+		return ClientStats{}, ErrClientNotFound
+	}
+
+	activity := client.activity()
+	return ClientStats{
+		ClientGUID:   client.ClientGUID(),
+		Pattern:      client.Handler().wsOpts.pattern,
+		ConnectedAt:  activity.connectedAt,
+		LastRead:     unixNanoTime(activity.lastRead.Load()),
+		LastWrite:    unixNanoTime(activity.lastWrite.Load()),
+		RTT:          time.Duration(activity.rtt.Load()),
+		QueueLength:  client.queue().len(),
+		SlowConsumer: client.queue().slowConsumerStats(),
+	}, nil
+}
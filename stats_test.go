@@ -0,0 +1,66 @@
+package uwebsocket
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	h, c1, _ := createTestSetup(t, ctx)
+
+	stats := h.Stats()
+	require.Equal(t, 2, stats.Clients)
+	require.Equal(t, map[string]int{"": 2}, stats.ClientsByPattern)
+	require.Greater(t, stats.Uptime, time.Duration(0))
+
+	// snapshots can be taken while sending
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			_ = h.Stats()
+			_, _ = h.ClientStats(testClientGUID1)
+		}
+	}()
+	for i := 0; i < 4; i++ {
+		h.Send(WithMessage(message1), WithClientFilter(testClientGUID1))
+	}
+	wg.Wait()
+
+	// dropping the oldest message counts as overflow as well
+	h.Send(WithMessage(message1), WithClientFilter(testClientGUID1), WithOverflowPolicy(OverflowDropOldest))
+
+	stats = h.Stats()
+	require.Equal(t, int64(2), stats.Drops[DropBufferFull])
+	require.Equal(t, int64(0), stats.Drops[DropTimeout])
+	require.Equal(t, int64(0), stats.Drops[DropExpired])
+	require.Equal(t, 3, stats.QueueDepth)
+	require.Equal(t, 3, stats.PeakQueueDepth)
+
+	clientStats, err := h.ClientStats(testClientGUID1)
+	require.NoError(t, err)
+	require.Equal(t, testClientGUID1, clientStats.ClientGUID)
+	require.Equal(t, 3, clientStats.QueueLength)
+	require.Equal(t, int64(2), clientStats.SlowConsumer.TotalDrops)
+	require.False(t, clientStats.ConnectedAt.IsZero())
+	require.True(t, clientStats.LastWrite.IsZero())
+
+	// the peak remains after the buffer was drained
+	for i := 0; i < 3; i++ {
+		_, err := c1.readOne()
+		require.NoError(t, err)
+	}
+	stats = h.Stats()
+	require.Equal(t, 0, stats.QueueDepth)
+	require.Equal(t, 3, stats.PeakQueueDepth)
+
+	_, err = h.ClientStats("unknown")
+	require.ErrorIs(t, err, ErrClientNotFound)
+}
@@ -0,0 +1,48 @@
+package uwebsocket
+
+import (
+	"context"
+	"net/http"
+)
+
+// A websocket subprotocol (Sec-WebSocket-Protocol) supported by a handler
+type Subprotocol struct {
+	// Name as requested by clients, e.g. "graphql-transport-ws"
+	Name string
+	// websocket.TextMessage or websocket.BinaryMessage for messages sent to
+	// clients using this subprotocol (0: the messageType of the hub)
+	MessageType int
+	// Handles incoming messages of clients using this subprotocol (nil: the handler's WithOnIncomingMessage)
+	OnIncomingMessage func(hub WebSocketHub, clientGuid string, clientAttributes *ClientAttributes, r *http.Request, msg ClientMessage, ctx context.Context)
+}
+
+type subprotocolCtxKey struct{}
+
+// Returns the subprotocol negotiated with the client, the context passed into
+// all callbacks of a handler contains it ("" if none was negotiated)
+func SubprotocolFromContext(ctx context.Context) string {
+	if subprotocol, ok := ctx.Value(subprotocolCtxKey{}).(string); ok {
+		return subprotocol
+	}
+	return ""
+}
+
+func (o handlerOptions) subprotocolNames() []string {
+	if len(o.subprotocols) == 0 {
+		return nil
+	}
+	names := make([]string, len(o.subprotocols))
+	for i := range o.subprotocols {
+		names[i] = o.subprotocols[i].Name
+	}
+	return names
+}
+
+func (o handlerOptions) subprotocol(name string) *Subprotocol {
+	for i := range o.subprotocols {
+		if o.subprotocols[i].Name == name {
+			return &o.subprotocols[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package uwebsocket
+
+import "time"
+
+// tokenBucket refills with rate tokens per second up to burst, it is not safe for concurrent use.
+// Taking more than burst tokens at once is possible with a full bucket, the bucket then goes into debt.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+// takes n tokens if available
+func (b *tokenBucket) take(now time.Time, n float64) bool {
+	b.refill(now)
+	if b.tokens < min(n, b.burst) {
+		return false
+	}
+	b.tokens -= n
+	return true
+}
+
+// takes n tokens, even if that puts the bucket into debt,
+// and returns how long until the debt is paid off
+func (b *tokenBucket) reserve(now time.Time, n float64) time.Duration {
+	b.refill(now)
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// how long until n tokens can be taken
+func (b *tokenBucket) wait(now time.Time, n float64) time.Duration {
+	b.refill(now)
+	missing := min(n, b.burst) - b.tokens
+	if missing <= 0 {
+		return 0
+	}
+	return time.Duration(missing / b.rate * float64(time.Second))
+}
+
+// a full bucket behaves like a new one and can be forgotten
+func (b *tokenBucket) full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
@@ -6,7 +6,11 @@ package uwebsocket
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
+	"errors"
+	"log/slog"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -24,6 +28,12 @@ const (
 
 	// Maximum message size allowed from peer.
 	maxMessageSize = 512
+
+	// Maximum number of messages buffered for a client.
+	sendBufferSize = 256
+
+	// Time allowed for the peer to answer the close-frame before the connection is closed.
+	closeGracePeriod = time.Second
 )
 
 var (
@@ -31,15 +41,24 @@ var (
 	space   = []byte{' '}
 )
 
+// A client connected to the hub.
+//
+// Breaking change: SendChan was removed. Outbound messages are kept in a bounded queue with priorities
+// and overflow policies instead of a channel, use WebSocketHub.Send, SendCtx or SendToClient to reach a client.
+// The interface has unexported methods, so it can only be implemented by this package (see WebSocketClientMock).
 type WebSocketClient interface {
 	ClientGUID() string
 	Attributes() *ClientAttributes
-	SendChan() chan []byte
 	Ctx() context.Context
 	Cancel()
 	Handler() Handler
 	Request() *http.Request
+	Subprotocol() string
 	Run(ctx context.Context)
+
+	queue() *sendQueue
+	messageHandler() func(ClientMessage)
+	activity() *clientActivity
 }
 
 // Client is a middleman between the websocket connection and the hub.
@@ -49,17 +68,44 @@ type webSocketClient struct {
 	// The websocket connection.
 	conn *websocket.Conn
 
-	// Buffered channel of outbound messages.
-	send chan []byte
+	// Buffered outbound messages.
+	send *sendQueue
 
 	// ClientAttributes
 	connectRequest *http.Request
 	clientGUID     string
 	attributes     *ClientAttributes
 
-	handler   Handler
-	ctx       context.Context
-	ctxCancel context.CancelFunc
+	handler     Handler
+	subprotocol string
+	ctx         context.Context
+	ctxCancel   context.CancelFunc
+
+	// bytes written to the network, only tracked if compression was negotiated
+	wireBytes *atomic.Int64
+
+	// called by the hub for incoming messages
+	onMessage func(ClientMessage)
+
+	activityStats *clientActivity
+
+	// frees the admission of the connection once it is closed
+	release func()
+
+	// nil without WithInboundRateLimit
+	inbound *inboundLimiter
+
+	// nil without WithBandwidthLimit
+	shaper *clientShaper
+
+	// nil without WithIdleTimeout
+	idle *idleTracker
+
+	// taken from the queue while collecting a batch, but not batchable, it is written next (only used by the writePump)
+	deferred *queuedMessage
+
+	// closed once the readPump exited
+	readDone chan struct{}
 }
 
 func (c *webSocketClient) ClientGUID() string {
@@ -70,10 +116,18 @@ func (c *webSocketClient) Attributes() *ClientAttributes {
 	return c.attributes
 }
 
-func (c *webSocketClient) SendChan() chan []byte {
+func (c *webSocketClient) queue() *sendQueue {
 	return c.send
 }
 
+func (c *webSocketClient) messageHandler() func(ClientMessage) {
+	return c.onMessage
+}
+
+func (c *webSocketClient) activity() *clientActivity {
+	return c.activityStats
+}
+
 func (c *webSocketClient) Ctx() context.Context {
 	return c.ctx
 }
@@ -90,16 +144,28 @@ func (c *webSocketClient) Request() *http.Request {
 	return c.connectRequest
 }
 
+func (c *webSocketClient) Subprotocol() string {
+	return c.subprotocol
+}
+
 func (c *webSocketClient) Run(ctx context.Context) {
-	go c.writePump(ctx)
-	go c.readPump(ctx)
+	c.readDone = make(chan struct{})
+	c.hub.pumps.add(2)
+	go func() {
+		defer c.hub.pumps.done()
+		c.writePump(ctx)
+	}()
+	go func() {
+		defer c.hub.pumps.done()
+		c.readPump(ctx)
+	}()
 }
 
 func (c *webSocketClient) handleError(err error) {
 	if c.handler.wsOpts.onError != nil {
 		(*c.handler.wsOpts.onError)(c.hub, c.clientGUID, c.attributes, c.connectRequest, err, c.ctx)
 	} else {
-		c.hub.u.Log().Errorf("%s", err)
+		c.hub.logClientEvent(c, LogEventClientError, "uwebsocket: client error", slog.Any("error", err))
 	}
 }
 
@@ -112,9 +178,17 @@ func (c *webSocketClient) readPump(ctx context.Context) {
 	readContext, cancel := context.WithCancel(ctx)
 
 	defer func() {
-		c.hub.unregister <- c
+		close(c.readDone)
+		// once the hub stopped running, it already removed all clients
+		select {
+		case c.hub.unregister <- c:
+		case <-c.hub.ctx.Done():
+		}
 		c.conn.Close()
 		cancel()
+		if c.release != nil {
+			c.release()
+		}
 	}()
 
 	c.conn.SetReadLimit(maxMessageSize)
@@ -125,6 +199,13 @@ func (c *webSocketClient) readPump(ctx context.Context) {
 	}
 
 	c.conn.SetPongHandler(func(input string) error {
+		// pings carry the time they were sent at
+		if len(input) == 8 {
+			sentAt := time.Unix(0, int64(binary.BigEndian.Uint64([]byte(input))))
+			rtt := time.Since(sentAt)
+			c.activityStats.rtt.Store(int64(rtt))
+			c.hub.metrics.ping(c.handler.wsOpts.pattern, rtt)
+		}
 		err = c.conn.SetReadDeadline(time.Now().Add(pongWait))
 		if err != nil {
 			cancel()
@@ -133,6 +214,9 @@ func (c *webSocketClient) readPump(ctx context.Context) {
 		return nil
 	})
 
+	// once the client is being disconnected, everything it sends is ignored until the connection is closed
+	disconnecting := false
+
 	for {
 		if err := readContext.Err(); err != nil {
 			c.handleError(err)
@@ -148,17 +232,54 @@ func (c *webSocketClient) readPump(ctx context.Context) {
 			c.handleError(err)
 			return
 		}
+		if disconnecting {
+			continue
+		}
+		if c.inbound != nil {
+			process, disconnect := c.limitInbound(readContext, len(message))
+			if disconnect {
+				disconnecting = true
+				// the warning (if any) is still written before the close-frame
+				c.hub.clientLock.Lock()
+				if registered, ok := c.hub.clients[c.clientGUID]; ok && registered == c {
+					c.hub.recordClosed(c, c.send.closeWithCode(websocket.ClosePolicyViolation, "rate limit exceeded", false))
+					c.hub.removeClient(c, false, DisconnectRateLimited)
+				}
+				c.hub.clientLock.Unlock()
+			}
+			if !process {
+				continue
+			}
+		}
+
+		c.activityStats.lastRead.Store(time.Now().UnixNano())
+		c.hub.stats.messagesReceived.Add(1)
+		c.hub.stats.bytesReceived.Add(int64(len(message)))
+		c.hub.metrics.received(c.handler.wsOpts.pattern, len(message))
 		message = bytes.TrimSpace(bytes.ReplaceAll(message, newline, space))
 
 		// support client side ping-pong via text-message
 		if bytes.Equal(message, []byte("PING")) {
-			c.send <- []byte(`PONG`)
+			// never blocks, a client which does not read its messages must not stall reading
+			discarded, err := c.send.push(readContext, &queuedMessage{payload: []byte(`PONG`), priority: PriorityHigh, keepalive: true}, OverflowDropOldest)
+			if discarded {
+				c.hub.recordDrop(c, DropBufferFull)
+			}
+			if errors.Is(err, ErrClientGone) {
+				return
+			}
 			continue
 		}
+		if c.idle != nil {
+			c.idle.lastIncoming.Store(time.Now().UnixNano())
+		}
 
-		c.hub.incomingMessages <- ClientMessage{
+		select {
+		case c.hub.incomingMessages <- ClientMessage{
 			ClientGUID: c.clientGUID,
 			Message:    message,
+		}:
+		case <-readContext.Done():
 		}
 	}
 }
@@ -172,8 +293,31 @@ func (c *webSocketClient) writePump(ctx context.Context) {
 	writeContext, cancel := context.WithCancel(ctx)
 
 	ticker := time.NewTicker(pingPeriod)
+
+	// nil (never ready) without WithIdleTimeout, every check schedules the next one
+	var idleTimer *time.Timer
+	var idleCheck <-chan time.Time
+	if c.idle != nil {
+		idleTimer = time.NewTimer(0)
+		idleCheck = idleTimer.C
+	}
+
+	// set while a batch waits for bandwidth budget, nothing else is written meanwhile
+	var throttled *throttledBatch
+
 	defer func() {
+		if throttled != nil {
+			throttled.drop(c)
+		}
+		if c.shaper != nil {
+			c.shaper.leave()
+		}
+		if idleTimer != nil {
+			idleTimer.Stop()
+		}
 		ticker.Stop()
+		// nothing is written anymore, blocked producers get ErrClientGone instead of waiting for the unregister
+		c.hub.recordClosed(c, c.send.close(true))
 		c.conn.Close()
 		cancel()
 	}()
@@ -184,48 +328,247 @@ func (c *webSocketClient) writePump(ctx context.Context) {
 			break
 		}
 
-		select {
-		case message, ok := <-c.send:
-			err := c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err != nil {
-				c.handleError(err)
-				return
-			}
+		// only waited for while throttled (nil channels are never ready)
+		var throttleDone <-chan time.Time
+		var clientDone <-chan struct{}
+		if throttled != nil {
+			throttleDone = throttled.timer.C
+			clientDone = c.ctx.Done()
+		}
 
-			if !ok {
-				// The hub closed the channel.
-				err = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
-				if err != nil {
-					c.handleError(err)
+		var batch []*queuedMessage
+		select {
+		case <-writeContext.Done():
+			continue
+		case <-c.send.notify:
+			if throttled != nil {
+				if !c.send.wasDiscarded() {
+					// everything new is written after the throttled batch
+					continue
 				}
-				return
+				throttled.drop(c)
+				throttled = nil
 			}
-
-			w, err := c.conn.NextWriter(c.hub.messageType)
+		case <-throttleDone:
+			batch = throttled.release(c)
+			throttled = nil
+		case <-clientDone:
+			// the client was removed, what is left is written without waiting for budget (unless it is discarded)
+			if c.send.wasDiscarded() {
+				throttled.drop(c)
+			} else {
+				batch = throttled.release(c)
+			}
+			throttled = nil
+		case <-ticker.C:
+			err := c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if err != nil {
 				c.handleError(err)
 				return
 			}
-			_, err = w.Write(message)
-			if err != nil {
+			payload := binary.BigEndian.AppendUint64(nil, uint64(time.Now().UnixNano()))
+			if err := c.conn.WriteMessage(websocket.PingMessage, payload); err != nil {
 				c.handleError(err)
 				return
 			}
+			continue
+		case <-idleCheck:
+			if next := c.checkIdle(writeContext); next > 0 {
+				idleTimer.Reset(next)
+			} else {
+				// the client is being closed
+				idleCheck = nil
+			}
+			continue
+		}
 
-			if err := w.Close(); err != nil {
+		if len(batch) > 0 {
+			if err := c.write(batch); err != nil {
 				c.handleError(err)
 				return
 			}
-		case <-ticker.C:
+		}
+		var closed bool
+		var err error
+		throttled, closed, err = c.writeQueued(writeContext)
+		if err != nil {
+			c.handleError(err)
+			return
+		}
+		if closed {
+			// The hub closed the queue.
 			err := c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err == nil {
+				err = c.conn.WriteMessage(websocket.CloseMessage, c.send.closePayload())
+			}
 			if err != nil {
 				c.handleError(err)
 				return
 			}
-			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				c.handleError(err)
-				return
+			// give the peer the chance to answer the close-frame, closing right away could make it miss the close-code
+			timer := time.NewTimer(closeGracePeriod)
+			defer timer.Stop()
+			select {
+			case <-c.readDone:
+			case <-timer.C:
 			}
+			return
+		}
+	}
+}
+
+// writes everything that is queued, either one frame per message or in batches.
+// Stops at the first batch which has to wait for bandwidth budget and returns it.
+func (c *webSocketClient) writeQueued(ctx context.Context) (throttled *throttledBatch, closed bool, err error) {
+	for {
+		batch, closed := c.nextBatch(ctx)
+		// once the client was removed, it no longer waits for budget
+		if c.shaper != nil && len(batch) > 0 && c.ctx.Err() == nil {
+			if throttled := c.throttle(batch); throttled != nil {
+				return throttled, false, nil
+			}
+		}
+		if len(batch) > 0 {
+			if err := c.write(batch); err != nil {
+				return nil, false, err
+			}
+		}
+		if closed || len(batch) == 0 {
+			return nil, closed, nil
 		}
 	}
 }
+
+// collects the next message (or batch of messages if enabled) which has not expired yet
+func (c *webSocketClient) nextBatch(ctx context.Context) (batch []*queuedMessage, closed bool) {
+	batching := c.handler.wsOpts.batching
+	size := 0
+	var delay <-chan time.Time
+
+	for {
+		var message *queuedMessage
+		var ok bool
+		if c.deferred != nil {
+			message, ok = c.deferred, true
+			c.deferred = nil
+			if c.send.wasDiscarded() {
+				c.hub.recordDrop(c, DropClosed)
+				continue
+			}
+		} else if message, ok, closed = c.send.next(); closed {
+			return batch, true
+		}
+
+		if !ok {
+			if batching == nil || batching.MaxDelay <= 0 || len(batch) == 0 {
+				return batch, false
+			}
+			if delay == nil {
+				timer := time.NewTimer(batching.MaxDelay)
+				defer timer.Stop()
+				delay = timer.C
+			}
+			select {
+			case <-c.send.notify:
+				continue
+			case <-delay:
+				return batch, false
+			case <-ctx.Done():
+				return batch, false
+			}
+		}
+
+		// do not write messages which waited too long in the queue
+		if message.expired(time.Now()) {
+			c.hub.recordDrop(c, DropExpired)
+			continue
+		}
+
+		if batching != nil && !message.batchable {
+			// written on its own, after the batch collected so far
+			if len(batch) > 0 {
+				c.deferred = message
+				return batch, false
+			}
+			return []*queuedMessage{message}, false
+		}
+
+		batch = append(batch, message)
+		size += len(message.payload)
+		if batching == nil || batching.full(len(batch), size) {
+			return batch, false
+		}
+	}
+}
+
+func (c *webSocketClient) write(batch []*queuedMessage) error {
+	err := c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	if err != nil {
+		return err
+	}
+
+	batching := c.handler.wsOpts.batching
+
+	size := 0
+	for _, message := range batch {
+		size += len(message.payload)
+	}
+	if compression := c.handler.wsOpts.compression; compression != nil {
+		c.conn.EnableWriteCompression(size >= compression.MinSize)
+	}
+	if c.wireBytes != nil {
+		defer c.trackCompression(size)
+	}
+
+	// broadcasts are framed (and compressed) only once for all clients with the same settings
+	framed := batching != nil && batch[0].batchable
+	messageType := c.messageType()
+	if framed && batching.Framing == FramingLengthPrefixed {
+		// the length prefixes are not valid UTF-8
+		messageType = websocket.BinaryMessage
+	}
+	c.activityStats.lastWrite.Store(time.Now().UnixNano())
+	if c.idle != nil {
+		c.idle.wrote(batch, time.Now())
+	}
+	c.hub.stats.messagesSent.Add(int64(len(batch)))
+	c.hub.stats.bytesSent.Add(int64(size))
+	c.hub.metrics.sent(c.handler.wsOpts.pattern, len(batch), size)
+	if batching == nil && batch[0].prepared != nil && messageType == c.hub.messageType {
+		return c.conn.WritePreparedMessage(batch[0].prepared)
+	}
+
+	w, err := c.conn.NextWriter(messageType)
+	if err != nil {
+		return err
+	}
+
+	if framed {
+		payloads := make([][]byte, len(batch))
+		for i := range batch {
+			payloads[i] = batch[i].payload
+		}
+		err = batching.Framing.write(w, payloads)
+	} else {
+		_, err = w.Write(batch[0].payload)
+	}
+	if err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+// adds the bytes of a write to the compression stats of the hub
+func (c *webSocketClient) trackCompression(payloadBytes int) {
+	c.hub.compressionPayloadBytes.Add(int64(payloadBytes))
+	c.hub.compressionWireBytes.Add(c.wireBytes.Swap(0))
+}
+
+// the negotiated subprotocol can override the message type of the hub
+func (c *webSocketClient) messageType() int {
+	if subprotocol := c.handler.wsOpts.subprotocol(c.subprotocol); subprotocol != nil && subprotocol.MessageType != 0 {
+		return subprotocol.MessageType
+	}
+	return c.hub.messageType
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"sync/atomic"
 	"testing"
 )
 
@@ -11,12 +12,13 @@ type WebSocketClientMock struct {
 	t            *testing.T
 	clientGUID   string
 	attributes   *ClientAttributes
-	sendChan     chan []byte
+	send         *sendQueue
 	ctx          context.Context
 	handler      Handler
 	r            *http.Request
-	calledCancel bool
-	calledRun    bool
+	calledCancel atomic.Bool
+	calledRun    atomic.Bool
+	stats        *clientActivity
 }
 
 func NewWebSocketClientMock(t *testing.T, ctx context.Context, guid string, attrs *ClientAttributes) *WebSocketClientMock {
@@ -24,25 +26,27 @@ func NewWebSocketClientMock(t *testing.T, ctx context.Context, guid string, attr
 		t:          t,
 		clientGUID: guid,
 		attributes: attrs,
-		sendChan:   make(chan []byte, 3),
+		send:       newSendQueue(3),
 		ctx:        ctx,
+		stats:      newClientActivity(),
 	}
 }
 
-func (c *WebSocketClientMock) ClientGUID() string            { return c.clientGUID }
-func (c *WebSocketClientMock) Attributes() *ClientAttributes { return c.attributes }
-func (c *WebSocketClientMock) SendChan() chan []byte         { return c.sendChan }
-func (c *WebSocketClientMock) Ctx() context.Context          { return c.ctx }
-func (c *WebSocketClientMock) Cancel()                       { c.calledCancel = true }
-func (c *WebSocketClientMock) Handler() Handler              { return c.handler }
-func (c *WebSocketClientMock) Request() *http.Request        { return c.r }
-func (c *WebSocketClientMock) Run(ctx context.Context)       { c.calledRun = true }
+func (c *WebSocketClientMock) ClientGUID() string                  { return c.clientGUID }
+func (c *WebSocketClientMock) Attributes() *ClientAttributes       { return c.attributes }
+func (c *WebSocketClientMock) Ctx() context.Context                { return c.ctx }
+func (c *WebSocketClientMock) Cancel()                             { c.calledCancel.Store(true) }
+func (c *WebSocketClientMock) Handler() Handler                    { return c.handler }
+func (c *WebSocketClientMock) Request() *http.Request              { return c.r }
+func (c *WebSocketClientMock) Subprotocol() string                 { return "" }
+func (c *WebSocketClientMock) Run(ctx context.Context)             { c.calledRun.Store(true) }
+func (c *WebSocketClientMock) queue() *sendQueue                   { return c.send }
+func (c *WebSocketClientMock) messageHandler() func(ClientMessage) { return nil }
+func (c *WebSocketClientMock) activity() *clientActivity           { return c.stats }
 
 func (c *WebSocketClientMock) readOne() ([]byte, error) {
-	select {
-	case msg := <-c.sendChan:
-		return msg, nil
-	default:
-		return nil, fmt.Errorf("buffer empty")
+	if msg, ok, _ := c.send.next(); ok {
+		return msg.payload, nil
 	}
+	return nil, fmt.Errorf("buffer empty")
 }
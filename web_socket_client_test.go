@@ -0,0 +1,162 @@
+package uwebsocket
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubprotocolSelection(t *testing.T) {
+	handler := NewHandler(WithSubprotocols(
+		Subprotocol{Name: "v2.json"},
+		Subprotocol{Name: "v2.binary", MessageType: websocket.BinaryMessage},
+	))
+	require.Equal(t, []string{"v2.json", "v2.binary"}, handler.wsOpts.subprotocolNames())
+	require.Nil(t, NewHandler().wsOpts.subprotocolNames())
+
+	hub := &webSocketHub{messageType: websocket.TextMessage}
+	require.Equal(t, websocket.TextMessage, (&webSocketClient{hub: hub, handler: handler}).messageType())
+	require.Equal(t, websocket.TextMessage, (&webSocketClient{hub: hub, handler: handler, subprotocol: "v2.json"}).messageType())
+	require.Equal(t, websocket.BinaryMessage, (&webSocketClient{hub: hub, handler: handler, subprotocol: "v2.binary"}).messageType())
+
+	ctx := context.WithValue(context.Background(), subprotocolCtxKey{}, "v2.json")
+	require.Equal(t, "v2.json", SubprotocolFromContext(ctx))
+	require.Equal(t, "", SubprotocolFromContext(context.Background()))
+}
+
+func TestFailedClientDoesNotBlockProducers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	h := NewHub(websocket.TextMessage, ctx).(*webSocketHub)
+
+	conns := make(chan *websocket.Conn)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conns <- conn
+	}))
+	defer server.Close()
+	connect := func() (*webSocketClient, *websocket.Conn) {
+		peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+		require.NoError(t, err)
+		conn := <-conns
+		t.Cleanup(func() {
+			peer.Close()
+			conn.Close()
+		})
+		clientCtx, clientCancel := context.WithCancel(ctx)
+		return &webSocketClient{
+			hub: h, conn: conn, send: newSendQueue(1), handler: NewHandler(),
+			ctx: clientCtx, ctxCancel: clientCancel, activityStats: newClientActivity(), readDone: make(chan struct{}),
+		}, peer
+	}
+
+	// a text PING is answered even if the buffer is full
+	client, peer := connect()
+	_, err := client.send.push(ctx, &queuedMessage{payload: message1}, OverflowDrop)
+	require.NoError(t, err)
+	go client.readPump(ctx)
+	require.NoError(t, peer.WriteMessage(websocket.TextMessage, []byte("PING")))
+	require.Eventually(t, func() bool { return h.stats.drops[DropBufferFull].Load() == 1 }, time.Second, 10*time.Millisecond)
+	message, ok, _ := client.send.next()
+	require.True(t, ok)
+	require.Equal(t, "PONG", string(message.payload))
+
+	// once writing failed, blocking sends return instead of waiting for the client to be unregistered
+	client, _ = connect()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.writePump(ctx)
+	}()
+	require.NoError(t, client.conn.UnderlyingConn().Close())
+	_, err = client.send.push(ctx, &queuedMessage{payload: message1}, OverflowBlock)
+	require.NoError(t, err)
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("writePump did not exit")
+	}
+	_, err = client.send.push(ctx, &queuedMessage{payload: message1}, OverflowBlock)
+	require.ErrorIs(t, err, ErrClientGone)
+}
+
+// Compares writing a broadcast to many clients with and without a shared prepared message
+//
+//	go test -run=^$ -bench=BenchmarkBroadcast -benchmem
+func BenchmarkBroadcast(b *testing.B) {
+	payload := bytes.Repeat([]byte(`{"symbol":"ABC","price":123.45,"volume":1000},`), 64)
+	for _, compression := range []bool{false, true} {
+		for _, prepared := range []bool{false, true} {
+			b.Run(fmt.Sprintf("compression=%t/prepared=%t", compression, prepared), func(b *testing.B) {
+				clients := createBenchmarkClients(b, 100, compression)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					msg := &queuedMessage{payload: payload}
+					if prepared {
+						var err error
+						msg.prepared, err = websocket.NewPreparedMessage(websocket.TextMessage, payload)
+						if err != nil {
+							b.Fatal(err)
+						}
+					}
+					for _, client := range clients {
+						if err := client.write([]*queuedMessage{msg}); err != nil {
+							b.Fatal(err)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+// creates server-side clients connected to peers which discard everything they receive
+func createBenchmarkClients(b *testing.B, count int, compression bool) []*webSocketClient {
+	hub := &webSocketHub{messageType: websocket.TextMessage, stats: newHubStats()}
+	upgrader := websocket.Upgrader{EnableCompression: compression}
+	conns := make(chan *websocket.Conn)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			b.Error(err)
+			return
+		}
+		conns <- conn
+	}))
+	b.Cleanup(server.Close)
+
+	dialer := websocket.Dialer{EnableCompression: compression}
+	clients := []*webSocketClient{}
+	for i := 0; i < count; i++ {
+		peer, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Cleanup(func() { peer.Close() })
+		go func() {
+			for {
+				if _, _, err := peer.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+
+		conn := <-conns
+		b.Cleanup(func() { conn.Close() })
+		clients = append(clients, &webSocketClient{hub: hub, conn: conn, handler: NewHandler(), activityStats: newClientActivity()})
+	}
+	return clients
+}
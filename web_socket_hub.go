@@ -7,12 +7,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
-	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/dunv/uhelpers"
 	"github.com/dunv/uhttp"
-	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
@@ -20,9 +22,19 @@ var ErrClientNotFound = errors.New("client not found")
 
 type WebSocketHub interface {
 	Send(opts ...SendOption)
+	SendCtx(ctx context.Context, opts ...SendOption) error
+	SendToClient(ctx context.Context, clientGUID string, opts ...SendOption) error
 	Run()
 	Handle(pattern string, handler Handler)
+	HTTPHandler(handler Handler) http.Handler
 	CountClientsWithFilter(filterFunc func(clientGUID string, attrs *ClientAttributes) bool) int
+	ListClients(filterFunc func(clientGUID string, attrs *ClientAttributes) bool, page Pagination) ([]ClientInfo, int)
+	AdminHandler(authorize func(r *http.Request) bool) http.Handler
+	Shutdown(ctx context.Context, opts ...ShutdownOption) error
+	Wait(ctx context.Context) error
+	CompressionStats() CompressionStats
+	Stats() Stats
+	ClientStats(clientGUID string) (ClientStats, error)
 }
 
 type webSocketHub struct {
@@ -31,12 +43,18 @@ type webSocketHub struct {
 	unregister       chan WebSocketClient
 	incomingMessages chan ClientMessage
 
-	// map[clientGUID]chan ClientMessage
+	// map[clientGUID]func(ClientMessage)
 	messageHandlers     map[string]func(ClientMessage)
 	messageHandlersLock *sync.Mutex
 
+	// optional, only required for Handle
 	u *uhttp.UHTTP
 
+	opts    hubOptions
+	logger  *slog.Logger
+	metrics *metrics
+	stats   *hubStats
+
 	// lock list
 	clientLock *sync.Mutex
 
@@ -50,16 +68,54 @@ type webSocketHub struct {
 	ctx context.Context
 
 	// how many messages were discarded because the client-buffer was full
-	discardedMessages int64
+	discardedMessages atomic.Int64
+
+	// how many messages were discarded because they expired before they could be written
+	expiredMessages atomic.Int64
+
+	// bytes written to clients with compression (before and after)
+	compressionPayloadBytes atomic.Int64
+	compressionWireBytes    atomic.Int64
+
+	// set by Shutdown, no more clients are accepted
+	shuttingDown atomic.Bool
+
+	// read- and write-pumps of all clients
+	pumps pumpTracker
 }
 
-func NewWebSocketHub(u *uhttp.UHTTP, messageType int, ctx context.Context) WebSocketHub {
-	return &webSocketHub{
+// Creates a hub which is integrated with uhttp: it uses its logger, the origins configured
+// for CORS (unless an origin policy is configured) and Handle registers on its ServeMux.
+// The CORS origins are compared with the Origin header, not the Host of the request.
+func NewWebSocketHub(u *uhttp.UHTTP, messageType int, ctx context.Context, opts ...HubOption) WebSocketHub {
+	hub := newHub(messageType, ctx, append([]HubOption{WithLogger(u.Log())}, opts...)...)
+	hub.u = u
+	if hub.opts.originPolicy == nil {
+		hub.opts.originPolicy = uhelpers.Ptr(corsOriginPolicy(u.CORS))
+	}
+	return hub
+}
+
+// Creates a hub without uhttp, mount the handlers returned by HTTPHandler on any router.
+// Without an origin policy, only same-origin connections are allowed from browsers.
+func NewHub(messageType int, ctx context.Context, opts ...HubOption) WebSocketHub {
+	return newHub(messageType, ctx, opts...)
+}
+
+func newHub(messageType int, ctx context.Context, opts ...HubOption) *webSocketHub {
+	mergedOpts := hubOptions{
+		logger: slog.Default(),
+	}
+	for _, opt := range opts {
+		opt.apply(&mergedOpts)
+	}
+	h := &webSocketHub{
+		opts:             mergedOpts,
+		logger:           mergedOpts.logger,
 		register:         make(chan WebSocketClient),
 		unregister:       make(chan WebSocketClient),
 		clients:          make(map[string]WebSocketClient),
 		incomingMessages: make(chan ClientMessage),
-		u:                u,
 		clientLock:       &sync.Mutex{},
 		messageType:      messageType,
 		ctx:              ctx,
@@ -69,47 +125,152 @@ func NewWebSocketHub(u *uhttp.UHTTP, messageType int, ctx context.Context) WebSo
 		},
 		messageHandlers:     make(map[string]func(ClientMessage)),
 		messageHandlersLock: &sync.Mutex{},
+		stats:               newHubStats(),
 	}
+
+	if mergedOpts.metrics != nil {
+		metrics, err := newMetrics(mergedOpts.metrics)
+		if err != nil {
+			h.logEvent(LogEventHandle, "uwebsocket: could not register metrics", slog.Any("error", err))
+		}
+		h.metrics = metrics
+	}
+	return h
 }
 
-func CreateHubAndRunInBackground(u *uhttp.UHTTP, messageType int, ctx context.Context) WebSocketHub {
-	hub := NewWebSocketHub(u, messageType, ctx)
+func CreateHubAndRunInBackground(u *uhttp.UHTTP, messageType int, ctx context.Context, opts ...HubOption) WebSocketHub {
+	hub := NewWebSocketHub(u, messageType, ctx, opts...)
 	go func() {
 		hub.Run()
 	}()
 	return hub
 }
 
-func (h *webSocketHub) upgradeConnection(handler Handler, clientGuid string, clientAttributes *ClientAttributes, w http.ResponseWriter, r *http.Request, clientContext context.Context, clientContextCancel context.CancelFunc) error {
-	h.upgrader.CheckOrigin = func(r *http.Request) bool {
-		if h.u.CORS() == "*" {
-			return true
+// evaluates the origin policy of the handler (or the hub's default) against the Origin header
+func (h *webSocketHub) checkOrigin(handler Handler, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	policy := AllowSameOrigin()
+	if handler.wsOpts.originPolicy != nil {
+		policy = *handler.wsOpts.originPolicy
+	} else if h.opts.originPolicy != nil {
+		policy = *h.opts.originPolicy
+	}
+	if policy(origin, r) {
+		return true
+	}
+
+	h.logEvent(LogEventOriginRejected, "uwebsocket: rejected connection from origin",
+		slog.String("origin", origin),
+		slog.String("remoteAddr", r.RemoteAddr),
+		slog.String("pattern", handler.wsOpts.pattern),
+	)
+	if h.opts.onOriginRejected != nil {
+		(*h.opts.onOriginRejected)(h, origin, r)
+	}
+	return false
+}
+
+// headers of the handshake response, the header of the client GUID takes precedence
+func (h *webSocketHub) responseHeader(handler Handler, clientGuid string, clientAttributes *ClientAttributes, r *http.Request) (http.Header, error) {
+	header := http.Header{}
+	if handler.wsOpts.responseHeaders != nil {
+		computed, err := (*handler.wsOpts.responseHeaders)(h, clientGuid, clientAttributes, r)
+		if err != nil {
+			return nil, err
 		}
-		for _, host := range strings.Split(h.u.CORS(), ",") {
-			if host == r.Host {
-				return true
+		for key, values := range computed {
+			for _, value := range values {
+				header.Add(key, value)
 			}
 		}
-		return false
+	}
+	if handler.wsOpts.clientGUIDHeader != "" {
+		header.Set(handler.wsOpts.clientGUIDHeader, clientGuid)
+	}
+	return header, nil
+}
+
+func (h *webSocketHub) upgradeConnection(handler Handler, clientGuid string, clientAttributes *ClientAttributes, w http.ResponseWriter, r *http.Request, clientContext context.Context, clientContextCancel context.CancelFunc, release func(), onMessage func(client *webSocketClient) func(ClientMessage)) (*webSocketClient, error) {
+	// the origin was already checked before (checkOrigin)
+	upgrader := h.upgrader
+	upgrader.CheckOrigin = func(r *http.Request) bool { return true }
+	compression := handler.wsOpts.compression
+	upgrader.EnableCompression = compression != nil
+	upgrader.Subprotocols = handler.wsOpts.subprotocolNames()
+
+	// count bytes on the wire to be able to report the compression ratio
+	var wireBytes *atomic.Int64
+	if compression != nil && requestsCompression(r) {
+		wireBytes = &atomic.Int64{}
+		w = &countingResponseWriter{ResponseWriter: w, written: wireBytes}
 	}
 
-	conn, err := h.upgrader.Upgrade(w, r, nil)
+	responseHeader, err := h.responseHeader(handler, clientGuid, clientAttributes, r)
 	if err != nil {
-		return fmt.Errorf("Could not Upgrade connection (%s)", err)
+		return nil, fmt.Errorf("Could not compute response headers (%s)", err)
+	}
+
+	conn, err := upgrader.Upgrade(w, r, responseHeader)
+	if err != nil {
+		return nil, fmt.Errorf("Could not Upgrade connection (%s)", err)
+	}
+	if compression != nil {
+		if err := conn.SetCompressionLevel(compression.level()); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("Could not set compression level (%s)", err)
+		}
+	}
+	if wireBytes != nil {
+		// do not count the handshake
+		wireBytes.Store(0)
 	}
+
 	client := &webSocketClient{
 		hub:            h,
 		conn:           conn,
-		send:           make(chan []byte, 256),
+		send:           newSendQueue(sendBufferSize),
 		clientGUID:     clientGuid,
 		attributes:     clientAttributes,
 		connectRequest: r,
 		handler:        handler,
-		ctx:            clientContext,
+		subprotocol:    conn.Subprotocol(),
+		ctx:            context.WithValue(clientContext, subprotocolCtxKey{}, conn.Subprotocol()),
 		ctxCancel:      clientContextCancel,
+		wireBytes:      wireBytes,
+		activityStats:  newClientActivity(),
+		release:        release,
+	}
+	if handler.wsOpts.inboundRateLimit != nil {
+		client.inbound = newInboundLimiter(*handler.wsOpts.inboundRateLimit)
+	}
+	if handler.wsOpts.bandwidth != nil {
+		client.shaper = handler.wsOpts.bandwidth.join(clientAttributes)
 	}
-	client.hub.register <- client
-	return nil
+	if handler.wsOpts.idleTimeout != nil {
+		client.idle = newIdleTracker(*handler.wsOpts.idleTimeout, time.Now())
+	}
+	client.onMessage = onMessage(client)
+	select {
+	case h.register <- client:
+	case <-h.ctx.Done():
+		conn.Close()
+		if client.shaper != nil {
+			client.shaper.leave()
+		}
+		return nil, errors.New("hub stopped")
+	}
+	return client, nil
+}
+
+func (h *webSocketHub) hasClient(clientGUID string) bool {
+	h.clientLock.Lock()
+	defer h.clientLock.Unlock()
+	_, ok := h.clients[clientGUID]
+	return ok
 }
 
 func (h *webSocketHub) CountClientsWithFilter(filterFunc func(clientGUID string, attrs *ClientAttributes) bool) int {
@@ -126,13 +287,54 @@ func (h *webSocketHub) CountClientsWithFilter(filterFunc func(clientGUID string,
 	return count
 }
 
+// Bytes written to all clients which negotiated compression
+func (h *webSocketHub) CompressionStats() CompressionStats {
+	return CompressionStats{
+		PayloadBytes: h.compressionPayloadBytes.Load(),
+		WireBytes:    h.compressionWireBytes.Load(),
+	}
+}
+
 // Pushes a message into the hub, there are no guarantees regarding message delivery
 //   - evaluates the filter, if no subscribers exist: return immediately
 //   - generates message once, and then caches it (if a messageFn is provided)
-//   - pumps the message into the send-channel of all matching clients
-//   - if the client-buffer is full, the message is discarded
-//   - the function always returns immediately
+//   - pumps the message into the send-buffer of all matching clients
+//   - if the client-buffer is full, the overflow-policy is applied (default: the message is discarded)
+//   - the function only blocks if OverflowBlock is used, at most until the hub is stopped
 func (h *webSocketHub) Send(opts ...SendOption) {
+	_ = h.SendCtx(h.ctx, opts...)
+}
+
+// Same as Send, but waiting for space in client-buffers (OverflowBlock)
+// is limited by the passed context. Clients are served one after another,
+// so a blocking client delays delivery to the ones following it.
+// Returns the context's error if it was done before all matching clients were served.
+func (h *webSocketHub) SendCtx(ctx context.Context, opts ...SendOption) error {
+	_, _, err := h.send(ctx, opts...)
+	return err
+}
+
+// Sends to a single client (replacing any filter) and reports what happened to the message
+//   - ErrClientNotFound: no client with the GUID is connected
+//   - ErrClientGone: the client disconnected while the message was enqueued
+//   - ErrBufferFull: the message was discarded by the overflow-policy
+//   - the context's error, if it was done while waiting for space (OverflowBlock)
+//   - the error of the messageFn
+func (h *webSocketHub) SendToClient(ctx context.Context, clientGUID string, opts ...SendOption) error {
+	matched, deliveryErr, err := h.send(ctx, append(opts, WithClientFilter(clientGUID))...)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return ErrClientNotFound
+	}
+	return deliveryErr
+}
+
+// enqueues the message for all matching clients, enqueueing to a client which is disconnecting is safe.
+// deliveryErr is the first error of an individual client (or of generating the message),
+// err is only set if ctx was done before all clients were served.
+func (h *webSocketHub) send(ctx context.Context, opts ...SendOption) (matched int, deliveryErr error, err error) {
 	sendOpts := &sendOptions{
 		filterFn: func(clientGUID string, attrs *ClientAttributes) bool { return true },
 	}
@@ -140,47 +342,186 @@ func (h *webSocketHub) Send(opts ...SendOption) {
 		opt(sendOpts)
 	}
 	if sendOpts.messageFn == nil {
-		h.u.Log().Errorf("uwebsocket: err no message or messageFn specified")
-		return
+		h.logEvent(LogEventMessageError, "uwebsocket: no message or messageFn specified")
+		return 0, errors.New("no message or messageFn specified"), nil
 	}
 
-	h.clientLock.Lock()
-	defer h.clientLock.Unlock()
-
-	// Cache generated message, this way the message-callback
-	// - is only called if there is at least one filter-match
-	// - is only called once for all clients
-	var generatedMessage []byte = nil
-	var generatedErr error
+	start := time.Now()
+	matches := []WebSocketClient{}
+	defer func() {
+		h.metrics.sendDone(len(matches), time.Since(start))
+	}()
 
+	// only evaluate the filter while holding the lock, a blocking send
+	// must not prevent clients from registering and unregistering
+	h.clientLock.Lock()
 	for i := range h.clients {
 		client := h.clients[i]
 		if sendOpts.filterFn(client.ClientGUID(), client.Attributes()) {
-			// if message generation already failed once, the error was logged and can be skipped this time around
-			if generatedErr != nil {
-				continue
-			}
+			matches = append(matches, client)
+		}
+	}
+	h.clientLock.Unlock()
 
-			// message was never generated -> do it here
-			if generatedMessage == nil {
-				generatedMessage, generatedErr = sendOpts.messageFn()
-				if generatedErr != nil {
-					h.u.Log().Errorf("uwebsocket: err generating msg: %w", generatedErr)
-					generatedMessage = []byte{}
-					continue
-				}
-			}
+	if len(matches) == 0 {
+		return 0, nil, nil
+	}
+
+	// Generate the message only once for all clients, the message-callback
+	// is only called if there is at least one filter-match
+	message, err := sendOpts.messageFn()
+	if err != nil {
+		h.logEvent(LogEventMessageError, "uwebsocket: could not generate message", slog.Any("error", err))
+		return len(matches), err, nil
+	}
+
+	// with multiple recipients, frame the message only once
+	var prepared *websocket.PreparedMessage
+	if len(matches) > 1 {
+		prepared, err = websocket.NewPreparedMessage(h.messageType, message)
+		if err != nil {
+			h.logEvent(LogEventMessageError, "uwebsocket: could not prepare message", slog.Any("error", err))
+			prepared = nil
+		}
+	}
+
+	for _, client := range matches {
+		policy := client.Handler().wsOpts.overflowPolicy
+		if sendOpts.overflowPolicy != nil {
+			policy = *sendOpts.overflowPolicy
+		}
 
-			// send synchronously here, as messages are buffered in the client
-			// if the buffer is full: discard
-			select {
-			case client.SendChan() <- generatedMessage:
-			default:
-				h.discardedMessages++
-				h.u.Log().Errorf("uwebsocket: buffer for client %s full, skipping msg", client.ClientGUID())
+		// messages are buffered in the client, only OverflowBlock waits here
+		discarded, err := client.queue().push(ctx, &queuedMessage{
+			payload:       message,
+			prepared:      prepared,
+			priority:      sendOpts.priority,
+			conflationKey: sendOpts.conflationKey,
+			expiresAt:     sendOpts.expiresAt,
+			batchable:     true,
+		}, policy)
+		if err == nil {
+			depth := client.queue().len()
+			h.metrics.queued(client.Handler().wsOpts.pattern, depth)
+			h.stats.trackQueueDepth(depth)
+		} else if deliveryErr == nil {
+			deliveryErr = err
+		}
+		if discarded {
+			// OverflowDropOldest discards without an error
+			if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+				h.recordDrop(client, DropTimeout)
+			} else {
+				h.recordDrop(client, DropBufferFull)
+			}
+			stats := client.queue().slowConsumerStats()
+			if (errors.Is(err, ErrBufferFull) && policy == OverflowDisconnect) || client.Handler().wsOpts.slowConsumer.exceeded(stats) {
+				h.evictSlowConsumer(client, stats)
+			} else if stats.ConsecutiveDrops == 1 {
+				// only log the beginning of a streak, not every single message
+				h.logClientEvent(client, LogEventBufferFull, "uwebsocket: client buffer full", slog.String("policy", policy.String()))
 			}
 		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return len(matches), deliveryErr, ctxErr
+		}
+	}
+	return len(matches), deliveryErr, nil
+}
+
+// disconnects a client immediately, discarding everything it has not received yet
+func (h *webSocketHub) evictSlowConsumer(client WebSocketClient, stats SlowConsumerStats) {
+	h.clientLock.Lock()
+	removed := h.closeClient(client, CloseSlowConsumer, "slow consumer", DisconnectSlowConsumer)
+	h.clientLock.Unlock()
+	if !removed {
+		return
+	}
+
+	h.logClientEvent(client, LogEventSlowConsumer, "uwebsocket: evicted slow consumer",
+		slog.Int("consecutiveDrops", stats.ConsecutiveDrops),
+		slog.Int("highWaterMark", stats.HighWaterMark),
+		slog.Duration("timeFull", stats.TimeFull),
+	)
+	if client.Handler().wsOpts.onSlowConsumer != nil {
+		(*client.Handler().wsOpts.onSlowConsumer)(h, client.ClientGUID(), client.Attributes(), client.Request(), stats, client.Ctx())
+	}
+}
+
+// counts a message which was not delivered to the client
+func (h *webSocketHub) recordDrop(client WebSocketClient, cause DropCause) {
+	if cause == DropExpired {
+		h.expiredMessages.Add(1)
+	} else {
+		h.discardedMessages.Add(1)
+	}
+	h.stats.drops[cause].Add(1)
+	h.metrics.dropped(client.Handler().wsOpts.pattern, cause)
+}
+
+// counts the messages which were discarded when the send-buffer of the client was closed
+func (h *webSocketHub) recordClosed(client WebSocketClient, discarded int) {
+	for i := 0; i < discarded; i++ {
+		h.recordDrop(client, DropClosed)
+	}
+}
+
+// removes the client, if it (and not another one with the same GUID) is registered
+// must be called with the clientLock held
+func (h *webSocketHub) removeClient(client WebSocketClient, discard bool, reason DisconnectReason) bool {
+	if registered, ok := h.clients[client.ClientGUID()]; !ok || registered != client {
+		return false
+	}
+	delete(h.clients, client.ClientGUID())
+	h.logClientEvent(client, LogEventDisconnect, "uwebsocket: client disconnected", slog.String("reason", string(reason)))
+	h.metrics.disconnected(client.Handler().wsOpts.pattern, reason)
+	h.messageHandlersLock.Lock()
+	delete(h.messageHandlers, client.ClientGUID())
+	h.messageHandlersLock.Unlock()
+	h.recordClosed(client, client.queue().close(discard))
+	client.Cancel()
+	return true
+}
+
+// removes the client, discarding everything it has not received yet and sending a close-frame with the code
+// must be called with the clientLock held
+func (h *webSocketHub) closeClient(client WebSocketClient, code int, text string, reason DisconnectReason) bool {
+	if registered, ok := h.clients[client.ClientGUID()]; !ok || registered != client {
+		return false
+	}
+	h.recordClosed(client, client.queue().closeWithCode(code, text, true))
+	return h.removeClient(client, true, reason)
+}
+
+// adds a client, resolving GUID collisions with the policy of the client's handler
+// must be called with the clientLock held
+func (h *webSocketHub) addClient(client WebSocketClient) bool {
+	if h.shuttingDown.Load() {
+		h.recordClosed(client, client.queue().closeWithCode(websocket.CloseGoingAway, "server shutting down", true))
+		client.Cancel()
+		return false
+	}
+	if existing, ok := h.clients[client.ClientGUID()]; ok {
+		if client.Handler().wsOpts.clientIDCollision != CollisionKickOld {
+			h.logClientEvent(client, LogEventDuplicateClient, "uwebsocket: rejected client with duplicate GUID")
+			h.recordClosed(client, client.queue().closeWithCode(CloseDuplicateClientID, "duplicate client id", true))
+			client.Cancel()
+			h.metrics.refused(client.Handler().wsOpts.pattern, DisconnectDuplicateClient)
+			return false
+		}
+		h.logClientEvent(client, LogEventDuplicateClient, "uwebsocket: replaced client with duplicate GUID")
+		h.closeClient(existing, CloseDuplicateClientID, "replaced by new connection", DisconnectDuplicateClient)
+	}
+
+	h.clients[client.ClientGUID()] = client
+	h.logClientEvent(client, LogEventConnect, "uwebsocket: client connected")
+	h.metrics.connected(client.Handler().wsOpts.pattern)
+	if onMessage := client.messageHandler(); onMessage != nil {
+		h.messageHandlersLock.Lock()
+		h.messageHandlers[client.ClientGUID()] = onMessage
+		h.messageHandlersLock.Unlock()
 	}
+	return true
 }
 
 func (h *webSocketHub) Run() {
@@ -189,78 +530,139 @@ func (h *webSocketHub) Run() {
 		case <-h.ctx.Done():
 			h.clientLock.Lock()
 			for _, client := range h.clients {
-				delete(h.clients, client.ClientGUID())
-				close(client.SendChan())
-				client.Cancel()
+				h.removeClient(client, false, DisconnectShutdown)
 			}
 			h.clientLock.Unlock()
 			return
 		case client := <-h.register:
 			h.clientLock.Lock()
-			h.clients[client.ClientGUID()] = client
+			added := h.addClient(client)
+			// a rejected client still needs its pumps to close the connection
 			client.Run(h.ctx)
 			h.clientLock.Unlock()
-			if client.Handler().wsOpts.welcomeMessages != nil {
+			if added && client.Handler().wsOpts.welcomeMessages != nil {
 				if welcomeMessages, err := (*client.Handler().wsOpts.welcomeMessages)(h, client.ClientGUID(), client.Attributes(), client.Request(), client.Ctx()); err == nil {
+					// Run must never wait for a client, the client might already be gone (ErrClientGone)
+					policy := client.Handler().wsOpts.overflowPolicy
+					if policy == OverflowBlock {
+						policy = OverflowDrop
+					}
 					for _, msg := range welcomeMessages {
-						client.SendChan() <- msg
+						if discarded, _ := client.queue().push(client.Ctx(), &queuedMessage{payload: msg, priority: PriorityHigh}, policy); discarded {
+							h.recordDrop(client, DropBufferFull)
+						}
 					}
 				} else {
-					h.u.Log().Errorf("Could not generate welcomeMessage %v", err)
+					h.logClientEvent(client, LogEventMessageError, "uwebsocket: could not generate welcome messages", slog.Any("error", err))
 				}
 			}
 		case client := <-h.unregister:
 			h.clientLock.Lock()
-			if _, ok := h.clients[client.ClientGUID()]; ok {
-				delete(h.clients, client.ClientGUID())
-				close(client.SendChan())
-				client.Cancel()
-			}
+			h.removeClient(client, false, DisconnectClosed)
 			h.clientLock.Unlock()
 		case clientMessage := <-h.incomingMessages:
+			// do not hold the lock while calling the handler, it might send or disconnect
 			h.messageHandlersLock.Lock()
-			for clientGUID, handler := range h.messageHandlers {
-				if clientMessage.ClientGUID == clientGUID {
-					handler(clientMessage)
-				}
-			}
+			handler, ok := h.messageHandlers[clientMessage.ClientGUID]
 			h.messageHandlersLock.Unlock()
+			if ok {
+				handler(clientMessage)
+			}
 		}
 	}
 }
 
+// Registers the handler on the ServeMux of uhttp, only available for hubs created with NewWebSocketHub.
+// Panics for hubs created with NewHub (like http.ServeMux for invalid registrations), use HTTPHandler instead.
 func (h *webSocketHub) Handle(pattern string, handler Handler) {
-	h.u.ServeMux().Handle(pattern, handler.wsOpts.uhttpHandler.WsReady(h.u)(func(w http.ResponseWriter, r *http.Request) {
-		clientGuid := uuid.New().String()
+	if h.u == nil {
+		panic(fmt.Sprintf("uwebsocket: Handle(%q) requires a hub created with NewWebSocketHub, use HTTPHandler instead", pattern))
+	}
+	if handler.wsOpts.pattern == "" {
+		handler.wsOpts.pattern = pattern
+	}
+	h.u.ServeMux().Handle(pattern, handler.wsOpts.uhttpHandler.WsReady(h.u)(h.HTTPHandler(handler).ServeHTTP))
+	h.logEvent(LogEventHandle, "uwebsocket: registered WS", slog.String("pattern", pattern))
+}
+
+// Returns a standard http.Handler which upgrades connections for the handler
+func (h *webSocketHub) HTTPHandler(handler Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.shuttingDown.Load() || h.ctx.Err() != nil {
+			http.Error(w, "server shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		if !h.checkOrigin(handler, r) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+
 		attributes := NewClientAttributes()
 		var err error
 		if handler.wsOpts.clientAttributes != nil {
 			attributes, err = (*handler.wsOpts.clientAttributes)(h, r)
 			if err != nil {
-				h.u.RenderError(w, r, fmt.Errorf("could not get required attributes (%s)", err))
+				h.renderError(w, r, fmt.Errorf("could not get required attributes (%s)", err))
 				return
 			}
 		}
-		clientContext, cancel := context.WithCancel(h.ctx)
-		err = h.upgradeConnection(handler, clientGuid, attributes, w, r, clientContext, cancel)
+
+		release, rejection, ok := h.admit(handler, r, attributes)
+		if !ok {
+			http.Error(w, "connection not admitted ("+string(rejection)+")", rejection.status())
+			return
+		}
+
+		generateClientID := defaultClientIDGenerator
+		if handler.wsOpts.clientIDGenerator != nil {
+			generateClientID = *handler.wsOpts.clientIDGenerator
+		}
+		clientGuid, err := generateClientID(r, attributes)
 		if err != nil {
-			h.u.RenderError(w, r, fmt.Errorf("could not upgrade connection (%s)", err))
-			cancel()
+			release()
+			h.renderError(w, r, fmt.Errorf("could not generate client id (%s)", err))
+			return
+		}
+		// random UUIDs do not collide, a collision which happens anyway is still handled by addClient
+		if handler.wsOpts.clientIDGenerator != nil && handler.wsOpts.clientIDCollision == CollisionRejectNew && h.hasClient(clientGuid) {
+			release()
+			http.Error(w, "client id already connected", http.StatusConflict)
 			return
 		}
 
-		if handler.wsOpts.onIncomingMessage != nil {
-			h.messageHandlersLock.Lock()
-			h.messageHandlers[clientGuid] = func(msg ClientMessage) {
-				(*handler.wsOpts.onIncomingMessage)(h, clientGuid, attributes, r, msg, clientContext)
+		clientContext, cancel := context.WithCancel(h.ctx)
+		client, err := h.upgradeConnection(handler, clientGuid, attributes, w, r, clientContext, cancel, release, func(client *webSocketClient) func(ClientMessage) {
+			onIncomingMessage := handler.wsOpts.onIncomingMessage
+			if subprotocol := handler.wsOpts.subprotocol(client.Subprotocol()); subprotocol != nil && subprotocol.OnIncomingMessage != nil {
+				onIncomingMessage = &subprotocol.OnIncomingMessage
 			}
-			h.messageHandlersLock.Unlock()
+			if onIncomingMessage == nil {
+				return nil
+			}
+			return func(msg ClientMessage) {
+				(*onIncomingMessage)(h, clientGuid, attributes, r, msg, client.Ctx())
+			}
+		})
+		if err != nil {
+			h.renderError(w, r, fmt.Errorf("could not upgrade connection (%s)", err))
+			cancel()
+			release()
+			return
 		}
+		// contains the negotiated subprotocol
+		clientContext = client.Ctx()
 
 		if handler.wsOpts.onConnect != nil {
 			(*handler.wsOpts.onConnect)(h, clientGuid, attributes, r, clientContext)
 		}
-	}))
+	})
+}
 
-	h.u.Log().Infof("Registered WS at %s", pattern)
+// uses the error rendering of uhttp if available
+func (h *webSocketHub) renderError(w http.ResponseWriter, r *http.Request, err error) {
+	if h.u != nil {
+		h.u.RenderError(w, r, err)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
 }
@@ -2,7 +2,13 @@ package uwebsocket
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -48,7 +54,7 @@ func TestMessageFilter(t *testing.T) {
 	require.Error(t, err)
 
 	// verify that no messages were discarded
-	require.Equal(t, int64(0), h.discardedMessages)
+	require.Equal(t, int64(0), h.discardedMessages.Load())
 }
 
 func TestMessageCache(t *testing.T) {
@@ -93,7 +99,7 @@ func TestMessageCache(t *testing.T) {
 	require.Equal(t, 1, calledMsg2Fn)
 
 	// verify that no messages were discarded
-	require.Equal(t, int64(0), h.discardedMessages)
+	require.Equal(t, int64(0), h.discardedMessages.Load())
 }
 
 func TestMessageBuffer(t *testing.T) {
@@ -129,11 +135,290 @@ func TestMessageBuffer(t *testing.T) {
 	require.Equal(t, message2, received)
 
 	// verify that two messages were discarded
-	require.Equal(t, int64(2), h.discardedMessages)
+	require.Equal(t, int64(2), h.discardedMessages.Load())
 }
 
-func createTestSetup(t *testing.T, ctx context.Context) (*webSocketHub, *WebSocketClientMock, *WebSocketClientMock) {
-	hInt := NewWebSocketHub(uhttp.NewUHTTP(), websocket.TextMessage, ctx)
+func TestOverflowPolicies(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	h, c1, c2 := createTestSetup(t, ctx)
+
+	// fill buffer of client 1, replace the oldest message
+	h.Send(WithMessage(message1), WithClientFilter(testClientGUID1))
+	h.Send(WithMessage(message1), WithClientFilter(testClientGUID1))
+	h.Send(WithMessage(message2), WithClientFilter(testClientGUID1))
+	h.Send(WithMessage(message3), WithClientFilter(testClientGUID1), WithOverflowPolicy(OverflowDropOldest))
+
+	received, err := c1.readOne()
+	require.NoError(t, err)
+	require.Equal(t, message1, received)
+	received, err = c1.readOne()
+	require.NoError(t, err)
+	require.Equal(t, message2, received)
+	received, err = c1.readOne()
+	require.NoError(t, err)
+	require.Equal(t, message3, received)
+	require.Equal(t, int64(1), h.discardedMessages.Load())
+
+	// fill buffer of client 1 again, blocking send times out
+	h.Send(WithMessage(message1), WithClientFilter(testClientGUID1))
+	h.Send(WithMessage(message1), WithClientFilter(testClientGUID1))
+	h.Send(WithMessage(message1), WithClientFilter(testClientGUID1))
+	blockCtx, blockCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer blockCancel()
+	err = h.SendCtx(blockCtx, WithMessage(message2), WithClientFilter(testClientGUID1), WithOverflowPolicy(OverflowBlock))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, int64(2), h.discardedMessages.Load())
+
+	// blocking send succeeds as soon as there is space
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_, _ = c1.readOne()
+	}()
+	err = h.SendCtx(ctx, WithMessage(message2), WithClientFilter(testClientGUID1), WithOverflowPolicy(OverflowBlock))
+	require.NoError(t, err)
+	require.Equal(t, int64(2), h.discardedMessages.Load())
+
+	// client 2 is disconnected as soon as its buffer overflows
+	for i := 0; i < 4; i++ {
+		h.Send(WithMessage(message1), WithClientFilter(testClientGUID2), WithOverflowPolicy(OverflowDisconnect))
+	}
+	require.True(t, c2.calledCancel.Load())
+	require.Equal(t, 1, h.CountClientsWithFilter(func(clientGUID string, attrs *ClientAttributes) bool { return true }))
+	_, err = c2.readOne()
+	require.Error(t, err)
+}
+
+func TestSlowConsumerEviction(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	h, c1, _ := createTestSetup(t, ctx)
+
+	var evicted *SlowConsumerStats
+	c1.handler = NewHandler(
+		WithSlowConsumerEviction(SlowConsumerPolicy{MaxConsecutiveDrops: 2}),
+		WithOnSlowConsumerEvicted(func(hub WebSocketHub, clientGuid string, clientAttributes *ClientAttributes, r *http.Request, stats SlowConsumerStats, ctx context.Context) {
+			evicted = &stats
+		}),
+	)
+
+	for i := 0; i < 4; i++ {
+		h.Send(WithMessage(message1), WithClientFilter(testClientGUID1))
+	}
+	require.Nil(t, evicted)
+	require.False(t, c1.calledCancel.Load())
+
+	h.Send(WithMessage(message1), WithClientFilter(testClientGUID1))
+	require.NotNil(t, evicted)
+	require.Equal(t, 2, evicted.ConsecutiveDrops)
+	require.Equal(t, 3, evicted.HighWaterMark)
+	require.True(t, c1.calledCancel.Load())
+	require.Equal(t, 1, h.CountClientsWithFilter(func(clientGUID string, attrs *ClientAttributes) bool { return true }))
+
+	// queued messages are discarded, the close-frame carries the dedicated code
+	_, err := c1.readOne()
+	require.Error(t, err)
+	require.Equal(t, websocket.FormatCloseMessage(CloseSlowConsumer, "slow consumer"), c1.send.closePayload())
+}
+
+func TestConflation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	h, c1, _ := createTestSetup(t, ctx)
+
+	h.Send(WithMessage(message1), WithClientFilter(testClientGUID1), WithConflationKey("price"))
+	h.Send(WithMessage(message2), WithClientFilter(testClientGUID1))
+	h.Send(WithMessage(message3), WithClientFilter(testClientGUID1), WithConflationKey("price"))
+
+	// full buffer does not matter when replacing
+	h.Send(WithMessage(message2), WithClientFilter(testClientGUID1))
+	h.Send(WithMessage(message1), WithClientFilter(testClientGUID1), WithConflationKey("price"))
+
+	// latest value replaced the first message in place
+	received, err := c1.readOne()
+	require.NoError(t, err)
+	require.Equal(t, message1, received)
+	received, err = c1.readOne()
+	require.NoError(t, err)
+	require.Equal(t, message2, received)
+	received, err = c1.readOne()
+	require.NoError(t, err)
+	require.Equal(t, message2, received)
+	_, err = c1.readOne()
+	require.Error(t, err)
+	require.Equal(t, int64(0), h.discardedMessages.Load())
+
+	// once sent, the key is queued again
+	h.Send(WithMessage(message3), WithClientFilter(testClientGUID1), WithConflationKey("price"))
+	received, err = c1.readOne()
+	require.NoError(t, err)
+	require.Equal(t, message3, received)
+}
+
+func TestPriorities(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	h, c1, _ := createTestSetup(t, ctx)
+
+	h.Send(WithMessage(message3), WithClientFilter(testClientGUID1), WithPriority(PriorityLow))
+	h.Send(WithMessage(message2), WithClientFilter(testClientGUID1))
+	h.Send(WithMessage(message1), WithClientFilter(testClientGUID1), WithPriority(PriorityHigh))
+
+	// dropping the oldest message never drops a message with higher priority
+	h.Send(WithMessage(message3), WithClientFilter(testClientGUID1), WithPriority(PriorityLow), WithOverflowPolicy(OverflowDropOldest))
+	h.Send(WithMessage(message1), WithClientFilter(testClientGUID1), WithPriority(PriorityHigh), WithOverflowPolicy(OverflowDropOldest))
+	require.Equal(t, int64(2), h.discardedMessages.Load())
+
+	received, err := c1.readOne()
+	require.NoError(t, err)
+	require.Equal(t, message1, received)
+	received, err = c1.readOne()
+	require.NoError(t, err)
+	require.Equal(t, message1, received)
+	received, err = c1.readOne()
+	require.NoError(t, err)
+	require.Equal(t, message2, received)
+	_, err = c1.readOne()
+	require.Error(t, err)
+}
+
+func TestResponseHeaders(t *testing.T) {
+	h := NewWebSocketHub(uhttp.NewUHTTP(), websocket.TextMessage, context.Background()).(*webSocketHub)
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	attrs := NewClientAttributes().SetString("session", "abc")
+
+	handler := NewHandler(
+		WithResponseHeaders(func(hub WebSocketHub, clientGuid string, clientAttributes *ClientAttributes, r *http.Request) (http.Header, error) {
+			session, err := clientAttributes.GetString("session")
+			if err != nil {
+				return nil, err
+			}
+			header := http.Header{}
+			header.Add("Set-Cookie", (&http.Cookie{Name: "session", Value: session}).String())
+			header.Set("X-Client-Id", "overridden")
+			return header, nil
+		}),
+		WithClientGUIDHeader("X-Client-Id"),
+	)
+	header, err := h.responseHeader(handler, testClientGUID1, attrs, r)
+	require.NoError(t, err)
+	require.Equal(t, "session=abc", header.Get("Set-Cookie"))
+	require.Equal(t, testClientGUID1, header.Get("X-Client-Id"))
+
+	// errors reject the connection
+	_, err = h.responseHeader(handler, testClientGUID1, NewClientAttributes(), r)
+	require.ErrorIs(t, err, KEY_DOES_NOT_EXIST_ERR)
+
+	header, err = h.responseHeader(NewHandler(), testClientGUID1, attrs, r)
+	require.NoError(t, err)
+	require.Empty(t, header)
+}
+
+func TestClientIDCollisions(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	h, c1, _ := createTestSetup(t, ctx)
+
+	// duplicate is rejected by default
+	rejected := NewWebSocketClientMock(t, ctx, testClientGUID1, NewClientAttributes())
+	h.register <- rejected
+	require.Eventually(t, func() bool { return rejected.calledRun.Load() }, time.Second, 10*time.Millisecond)
+	require.True(t, rejected.calledCancel.Load())
+	require.False(t, c1.calledCancel.Load())
+	require.Equal(t, websocket.FormatCloseMessage(CloseDuplicateClientID, "duplicate client id"), rejected.send.closePayload())
+
+	// unregistering the rejected client does not affect the registered one
+	h.unregister <- rejected
+	require.Equal(t, 2, h.CountClientsWithFilter(func(clientGUID string, attrs *ClientAttributes) bool { return true }))
+
+	// duplicate replaces the existing client
+	replacing := NewWebSocketClientMock(t, ctx, testClientGUID1, NewClientAttributes())
+	replacing.handler = NewHandler(WithClientIDCollisionPolicy(CollisionKickOld))
+	h.register <- replacing
+	require.Eventually(t, func() bool { return replacing.calledRun.Load() }, time.Second, 10*time.Millisecond)
+	require.False(t, replacing.calledCancel.Load())
+	require.True(t, c1.calledCancel.Load())
+	require.Equal(t, websocket.FormatCloseMessage(CloseDuplicateClientID, "replaced by new connection"), c1.send.closePayload())
+
+	h.Send(WithMessage(message1), WithClientFilter(testClientGUID1))
+	received, err := replacing.readOne()
+	require.NoError(t, err)
+	require.Equal(t, message1, received)
+}
+
+func TestClientIDCollisionBeforeUpgrade(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	h := NewHub(websocket.TextMessage, ctx)
+	go h.Run()
+	server := httptest.NewServer(h.HTTPHandler(NewHandler(
+		WithClientIDGenerator(func(r *http.Request, attrs *ClientAttributes) (string, error) {
+			return r.URL.Query().Get("id"), nil
+		}),
+	)))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "?id=" + testClientGUID1
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Eventually(t, func() bool {
+		return h.CountClientsWithFilter(func(clientGUID string, attrs *ClientAttributes) bool { return clientGUID == testClientGUID1 }) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	_, response, err := websocket.DefaultDialer.Dial(url, nil)
+	require.ErrorIs(t, err, websocket.ErrBadHandshake)
+	require.Equal(t, http.StatusConflict, response.StatusCode)
+}
+
+func TestHTTPHandler(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	h := NewHub(websocket.TextMessage, ctx)
+	go h.Run()
+	server := httptest.NewServer(h.HTTPHandler(NewHandler(
+		WithClientGUIDHeader("X-Client-Id"),
+		WithSubprotocols(Subprotocol{Name: "v2.json"}),
+		WithWelcomeMessages(func(hub WebSocketHub, clientGuid string, clientAttributes *ClientAttributes, r *http.Request, ctx context.Context) ([][]byte, error) {
+			return [][]byte{message1}, nil
+		}),
+		WithOnIncomingMessage(func(hub WebSocketHub, clientGuid string, clientAttributes *ClientAttributes, r *http.Request, msg ClientMessage, ctx context.Context) {
+			hub.Send(WithMessage([]byte(SubprotocolFromContext(ctx)+":"+string(msg.Message))), WithClientFilter(clientGuid))
+		}),
+	)))
+	defer server.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"v1", "v2.json"}}
+	conn, response, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, "v2.json", conn.Subprotocol())
+	require.NotEmpty(t, response.Header.Get("X-Client-Id"))
+
+	_, received, err := conn.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, message1, received)
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, message2))
+	_, received, err = conn.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, "v2.json:"+string(message2), string(received))
+
+	// browsers from other origins are rejected
+	_, response, err = websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), http.Header{"Origin": []string{"https://evil.com"}})
+	require.Error(t, err)
+	require.Equal(t, http.StatusForbidden, response.StatusCode)
+
+	// without uhttp there is no ServeMux to register on
+	require.PanicsWithValue(t, `uwebsocket: Handle("/ws") requires a hub created with NewWebSocketHub, use HTTPHandler instead`, func() {
+		h.Handle("/ws", NewHandler())
+	})
+}
+
+func createTestSetup(t *testing.T, ctx context.Context, opts ...HubOption) (*webSocketHub, *WebSocketClientMock, *WebSocketClientMock) {
+	hInt := NewWebSocketHub(uhttp.NewUHTTP(), websocket.TextMessage, ctx, opts...)
 	h := reflect.ValueOf(hInt).Interface().(*webSocketHub)
 	go h.Run()
 	client1 := NewWebSocketClientMock(t, ctx, testClientGUID1,
@@ -171,3 +456,81 @@ func createTestSetup(t *testing.T, ctx context.Context) (*webSocketHub, *WebSock
 	}
 
 }
+
+func TestSendToClient(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	h, c1, c2 := createTestSetup(t, ctx)
+
+	require.NoError(t, h.SendToClient(ctx, testClientGUID1, WithMessage(message1)))
+	received, err := c1.readOne()
+	require.NoError(t, err)
+	require.Equal(t, message1, received)
+
+	require.ErrorIs(t, h.SendToClient(ctx, "unknown", WithMessage(message1)), ErrClientNotFound)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, h.SendToClient(ctx, testClientGUID1, WithMessage(message1)))
+	}
+	require.ErrorIs(t, h.SendToClient(ctx, testClientGUID1, WithMessage(message1)), ErrBufferFull)
+
+	// the client is disconnecting, but not yet removed from the hub
+	c2.send.close(false)
+	require.ErrorIs(t, h.SendToClient(ctx, testClientGUID2, WithMessage(message1)), ErrClientGone)
+}
+
+func TestConcurrentSendWhileClientsChurn(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	h, _, _ := createTestSetup(t, ctx)
+	handler := NewHandler(
+		WithDefaultOverflowPolicy(OverflowBlock),
+		WithWelcomeMessages(func(hub WebSocketHub, clientGuid string, clientAttributes *ClientAttributes, r *http.Request, ctx context.Context) ([][]byte, error) {
+			return [][]byte{message1, message2, message3, message1, message2}, nil
+		}),
+	)
+
+	done := make(chan struct{})
+	senders := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		senders.Add(1)
+		go func(i int) {
+			defer senders.Done()
+			policies := []OverflowPolicy{OverflowDrop, OverflowBlock, OverflowDropOldest, OverflowDisconnect}
+			for j := 0; ; j++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				sendCtx, sendCancel := context.WithTimeout(ctx, time.Millisecond)
+				h.Send(WithMessage(message1), WithOverflowPolicy(policies[(i+j)%len(policies)]))
+				err := h.SendToClient(sendCtx, fmt.Sprintf("churn-%d-%d", i, j%50), WithMessage(message2), WithOverflowPolicy(OverflowBlock))
+				sendCancel()
+				if err != nil && !errors.Is(err, ErrClientNotFound) && !errors.Is(err, ErrClientGone) && !errors.Is(err, ErrBufferFull) && !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("unexpected error %v", err)
+				}
+			}
+		}(i)
+	}
+
+	churners := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		churners.Add(1)
+		go func(i int) {
+			defer churners.Done()
+			for j := 0; j < 200; j++ {
+				client := NewWebSocketClientMock(t, ctx, fmt.Sprintf("churn-%d-%d", i, j%50), NewClientAttributes())
+				client.handler = handler
+				h.register <- client
+				_, _ = client.readOne()
+				h.unregister <- client
+			}
+		}(i)
+	}
+
+	churners.Wait()
+	close(done)
+	senders.Wait()
+	require.NoError(t, ctx.Err())
+}